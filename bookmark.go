@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// Bookmark represent named stage of pipeline
+type Bookmark struct {
+	Name  string
+	Stage int
+	// commands are commands of stages up to the bookmark, which identify the stage
+	commands []string
+}
+
+// BookmarkPicker represent list of bookmarks of current buffer
+type BookmarkPicker struct {
+	cursor int
+}
+
+// timeline returns commands of stages and stages reverted by Undo, in order of Redo
+func (b *Buffer) timeline() []string {
+	return append(b.pipeline.Commands(), b.pipeline.UndoneCommands()...)
+}
+
+// AddBookmark marks current stage of current buffer with name, replacing bookmark of the same name
+func (v *MainView) AddBookmark(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("type name of bookmark")
+	}
+	b := &v.buffers[v.current]
+	n := b.pipeline.Len()
+	bm := Bookmark{Name: name, Stage: n, commands: b.pipeline.Commands()}
+
+	for i := range b.bookmarks {
+		if b.bookmarks[i].Name == name {
+			b.bookmarks[i] = bm
+			return fmt.Sprintf("bookmark %s moved to stage %d", name, n), nil
+		}
+	}
+	b.bookmarks = append(b.bookmarks, bm)
+	return fmt.Sprintf("bookmark %s added at stage %d", name, n), nil
+}
+
+// pruneBookmarks removes bookmarks of stages which have been discarded
+func (b *Buffer) pruneBookmarks() {
+	timeline := b.timeline()
+	var kept []Bookmark
+	for _, bm := range b.bookmarks {
+		if bm.Stage <= len(timeline) && equalStrings(bm.commands, timeline[:bm.Stage]) {
+			kept = append(kept, bm)
+		}
+	}
+	b.bookmarks = kept
+}
+
+// clampBookmarks keeps cursor of bookmark picker on a bookmark of current buffer, and closes picker when none is left
+func (v *MainView) clampBookmarks() {
+	p := v.bookmarks
+	if p == nil {
+		return
+	}
+	n := len(v.buffers[v.current].bookmarks)
+	if n < 1 {
+		v.bookmarks = nil
+		return
+	}
+	if p.cursor >= n {
+		p.cursor = n - 1
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// ToggleBookmarks opens or closes bookmark picker of current buffer
+func (v *MainView) ToggleBookmarks() error {
+	if v.bookmarks != nil {
+		v.bookmarks = nil
+		return nil
+	}
+	if len(v.buffers[v.current].bookmarks) < 1 {
+		return errors.New("no bookmark: type name and press Ctrl+K to add")
+	}
+	v.bookmarks = &BookmarkPicker{}
+	return nil
+}
+
+// JumpToBookmark moves pipeline of current buffer to stage of bookmark by undo or redo,
+// so that stages after it are kept restorable
+func (v *MainView) JumpToBookmark(bm Bookmark) {
+	v.Pipeline().Seek(bm.Stage)
+	v.syncText()
+}
+
+// DiffBookmark shows diff from text of bookmark to current text
+func (v *MainView) DiffBookmark(bm Bookmark) (string, error) {
+	p := v.Pipeline()
+	text := p.Snapshot(0)
+	if bm.Stage > p.Len() {
+		// Output of stages reverted by Undo is shown by redoing them temporarily
+		n := p.Len()
+		p.Seek(bm.Stage)
+		text = p.Text()
+		p.Seek(n)
+	} else if bm.Stage > 0 {
+		text = p.Snapshot(bm.Stage)
+	}
+
+	d, err := NewDiffView(v.displayText(text), v.textArea.text,
+		fmt.Sprintf("%s (stage %d)", bm.Name, bm.Stage), fmt.Sprintf("current (stage %d)", p.Len()))
+	if err != nil {
+		return "", err
+	}
+	v.diffView = d
+	v.textArea.offset = 0
+	return d.Summary(), nil
+}
+
+// HandleBookmarksKey handles key for bookmark picker, and reports whether key is consumed
+func (v *MainView) HandleBookmarksKey(ev termbox.Event) bool {
+	p := v.bookmarks
+	b := &v.buffers[v.current]
+	switch ev.Key {
+	case termbox.KeyArrowUp, termbox.KeyF5:
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case termbox.KeyArrowDown, termbox.KeyF6:
+		if p.cursor < len(b.bookmarks)-1 {
+			p.cursor++
+		}
+	case termbox.KeyEnter:
+		v.bookmarks = nil
+		if len(b.bookmarks) == 0 {
+			return true
+		}
+		v.JumpToBookmark(b.bookmarks[p.cursor])
+	case termbox.KeyTab:
+		v.bookmarks = nil
+		if len(b.bookmarks) == 0 {
+			return true
+		}
+		m, err := v.DiffBookmark(b.bookmarks[p.cursor])
+		if err != nil {
+			v.InputError(err.Error())
+			return true
+		}
+		v.InputError(m)
+	case termbox.KeyDelete, termbox.KeyCtrlD:
+		if len(b.bookmarks) == 0 {
+			v.bookmarks = nil
+			return true
+		}
+		b.bookmarks = append(b.bookmarks[:p.cursor], b.bookmarks[p.cursor+1:]...)
+		if len(b.bookmarks) < 1 {
+			v.bookmarks = nil
+		} else if p.cursor >= len(b.bookmarks) {
+			p.cursor--
+		}
+	case termbox.KeyCtrlL:
+		v.bookmarks = nil
+	default:
+		return false
+	}
+	return true
+}
+
+// drawBookmarks updates back buffer for bookmark picker over text area
+func (v *MainView) drawBookmarks() {
+	b := &v.buffers[v.current]
+	drawPaneTitle(v.screen, "bookmarks (Enter to jump, Tab to diff with current, Delete to remove)", 0, TextAreaPos, v.width)
+
+	timeline := b.timeline()
+	for n, bm := range b.bookmarks {
+		y := TextAreaPos + 1 + n
+		if y >= v.height {
+			return
+		}
+		fg := ColFg
+		if n == v.bookmarks.cursor {
+			fg |= termbox.AttrReverse
+		}
+		command := "source"
+		if bm.Stage > 0 {
+			command = timeline[bm.Stage-1]
+		}
+		mark := " "
+		if bm.Stage == b.pipeline.Len() {
+			mark = "*"
+		}
+
+		var x int
+		for _, c := range fmt.Sprintf("%s %-20s stage %-3d # %s", mark, bm.Name, bm.Stage, command) {
+			if x+runewidth.RuneWidth(c) > v.width {
+				break
+			}
+			v.screen.SetCell(x, y, c, fg, ColBg)
+			x += runewidth.RuneWidth(c)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// Buffer represent input file and its own pipeline
+type Buffer struct {
+	pipeline *pipeline.Pipeline
+	textArea TextArea
+	// encoding is encoding of text passed to commands, which is converted into UTF-8 for display
+	encoding string
+	// display is text converted last for display, kept since conversion runs iconv
+	display *displayCache
+	// full is full input when pipeline runs on its sample
+	full      *pipeline.Source
+	sampling  string
+	bookmarks []Bookmark
+}
+
+// displayCache represents text and its conversion into UTF-8
+type displayCache struct {
+	text      []byte
+	converted []byte
+}
+
+// DisplayName returns buffer name for display
+func (b *Buffer) DisplayName() string {
+	if b.pipeline.Source.Name == "" {
+		return "<stdin>"
+	}
+	return b.pipeline.Source.Name
+}
+
+// Source returns full input of buffer, even when pipeline runs on its sample
+func (b *Buffer) Source() pipeline.Source {
+	if b.full != nil {
+		return *b.full
+	}
+	return b.pipeline.Source
+}
+
+// storeBuffer saves state of text area into current buffer
+func (v *MainView) storeBuffer() {
+	v.buffers[v.current].textArea = v.textArea
+}
+
+// loadBuffer switches text area to buffer n
+func (v *MainView) loadBuffer(n int) {
+	v.current = n
+	v.textArea = v.buffers[n].textArea
+	v.bookmarks = nil
+	v.syncText()
+}
+
+// NextBuffer switches to next buffer
+func (v *MainView) NextBuffer() {
+	v.storeBuffer()
+	v.loadBuffer((v.current + 1) % len(v.buffers))
+}
+
+// PrevBuffer switches to previous buffer
+func (v *MainView) PrevBuffer() {
+	v.storeBuffer()
+	v.loadBuffer((v.current + len(v.buffers) - 1) % len(v.buffers))
+}
+
+// SetEnvironment applies env arguments to environment of commands of every buffer, and returns message of the result.
+// Current environment is shown when line is empty.
+func (v *MainView) SetEnvironment(line string) (string, error) {
+	for n := range v.buffers {
+		p := v.buffers[n].pipeline
+		env, err := pipeline.ParseEnvironment(p.Env, line)
+		if err != nil {
+			return "", err
+		}
+		p.Env = env
+	}
+
+	if env := v.Pipeline().Env; !env.Empty() {
+		return fmt.Sprint("environment: ", env.String()), nil
+	}
+	return "environment is inherited", nil
+}
+
+// ApplyToAllBuffers invokes command line on every buffer and returns error messages of failed buffers
+func (v *MainView) ApplyToAllBuffers(line string) []string {
+	var errs []string
+
+	for n := range v.buffers {
+		if _, err := v.buffers[n].pipeline.Run(line); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", v.buffers[n].DisplayName(), err.Error()))
+		}
+	}
+	v.syncText()
+
+	return errs
+}
+
+// tabs returns tab of each buffer with its name and stage count, and current one is marked with "*"
+func (v *MainView) tabs() string {
+	var tabs []string
+	for n := range v.buffers {
+		b := &v.buffers[n]
+		mark := ""
+		if n == v.current {
+			mark = "*"
+		}
+		tabs = append(tabs, fmt.Sprintf("[%s%d:%s (%d)]", mark, n+1, b.DisplayName(), b.pipeline.Len()))
+	}
+	return strings.Join(tabs, " ")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clipboardMaxSize is max bytes of text copied to clipboard, since terminals limit length of escape sequence
+const clipboardMaxSize = 1 << 20
+
+// Clipboard is Screen which can set text to system clipboard
+type Clipboard interface {
+	SetClipboard(text []byte) error
+}
+
+// OSC52 returns OSC 52 terminal escape sequence setting text to clipboard
+func OSC52(text []byte) string {
+	return fmt.Sprintf("\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString(text))
+}
+
+// CopyToClipboard sets text to clipboard by writing OSC 52 escape sequence to terminal
+func CopyToClipboard(text []byte) error {
+	if len(text) > clipboardMaxSize {
+		return fmt.Errorf("%d bytes are too large to copy to clipboard", len(text))
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := tty.WriteString(OSC52(text)); err != nil {
+		tty.Close()
+		return err
+	}
+	return tty.Close()
+}
+
+// copyText copies text to clipboard of screen and returns message of the result
+func (v *MainView) copyText(text []byte, what string) (string, error) {
+	c, ok := v.screen.(Clipboard)
+	if !ok {
+		return "", errors.New("clipboard is not available")
+	}
+	if err := c.SetClipboard(text); err != nil {
+		return "", fmt.Errorf("copy %s failed: %s", what, err.Error())
+	}
+	return fmt.Sprintf("copied %s (%d bytes) to clipboard", what, len(text)), nil
+}
+
+// CopyOneLiner copies one-liner of current buffer to clipboard
+func (v *MainView) CopyOneLiner() (string, error) {
+	return v.copyText([]byte(v.Pipeline().Shell()), "one-liner")
+}
+
+// CopyText copies text of current buffer to clipboard.
+// When line range such as "10", "10,20" or "10,$" is given, only the lines are copied.
+func (v *MainView) CopyText(lineRange string) (string, error) {
+	text := v.textArea.text
+	if lineRange == "" {
+		return v.copyText(text, "text")
+	}
+
+	lines := v.textArea.index.Len()
+	if bytes.HasSuffix(text, []byte("\n")) {
+		lines--
+	}
+	start, end, err := parseLineRange(lineRange, lines)
+	if err != nil {
+		return "", err
+	}
+	from, to := v.textArea.index.Offset(start-1), len(text)
+	if end < lines {
+		to = v.textArea.index.Offset(end)
+	}
+	return v.copyText(text[from:to], fmt.Sprintf("lines %d-%d", start, end))
+}
+
+// parseLineRange parses range of lines in sed address form, such as "10", "10,20" or "10,$".
+// Lines are numbered from 1 and end is inclusive.
+func parseLineRange(s string, lines int) (start, end int, err error) {
+	parse := func(a string) (int, error) {
+		if a == "$" {
+			return lines, nil
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(a))
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid line range %q: type such as 10,20 or 10,$", s)
+		}
+		return n, nil
+	}
+
+	r := strings.SplitN(s, ",", 2)
+	if start, err = parse(r[0]); err != nil {
+		return 0, 0, err
+	}
+	end = start
+	if len(r) > 1 {
+		if end, err = parse(r[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if start > end || end > lines {
+		return 0, 0, fmt.Errorf("line range %s is out of 1-%d", s, lines)
+	}
+	return start, end, nil
+}
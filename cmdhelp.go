@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// CommandHelp represent overlay of --help of command being typed in input area, with flag under cursor highlighted
+type CommandHelp struct {
+	// name is command whose help is shown, and flag is flag highlighted in it
+	name string
+	flag string
+	// text is help of command, which is nil until it is got
+	text   []byte
+	offset int
+}
+
+// usageFetch represents help of command got in background
+type usageFetch struct {
+	// done is closed when text is set
+	done chan struct{}
+	text []byte
+}
+
+// ToggleCommandHelp opens or closes help of command being typed
+func (v *MainView) ToggleCommandHelp() {
+	if v.commandHelp != nil {
+		v.commandHelp = nil
+		return
+	}
+	v.commandHelp = &CommandHelp{}
+}
+
+// HandleCommandHelpKey handles key for help of command, and reports whether key is consumed.
+// Other keys are left to input area so that help follows command being typed.
+func (v *MainView) HandleCommandHelpKey(ev termbox.Event) bool {
+	h := v.commandHelp
+	if h.name == "" {
+		return false
+	}
+	switch ev.Key {
+	case termbox.KeyPgup:
+		h.offset -= v.commandHelpHeight() / 2
+	case termbox.KeyPgdn:
+		h.offset += v.commandHelpHeight() / 2
+	case termbox.KeyEsc:
+		v.commandHelp = nil
+		return true
+	default:
+		return false
+	}
+	if max := NewLineIndex(h.text).Len() - 1; h.offset > max {
+		h.offset = max
+	}
+	if h.offset < 0 {
+		h.offset = 0
+	}
+	return true
+}
+
+// updateCommandHelp follows command and flag under cursor in input area.
+// Help of each command is got once and cached for the session.
+func (v *MainView) updateCommandHelp() {
+	h := v.commandHelp
+	name := firstWord(string(v.inputArea.text))
+	if name == "" || strings.HasPrefix(name, pipeline.BuiltinPrefix) || !v.Pipeline().Policy.Allowed(name) {
+		h.name, h.flag, h.text = "", "", nil
+		return
+	}
+	if name != h.name {
+		h.name, h.flag, h.text, h.offset = name, "", nil, 0
+	}
+	if h.text == nil {
+		f, ok := v.commandHelps[name]
+		if !ok {
+			f = v.fetchUsage(name)
+			v.commandHelps[name] = f
+		}
+		select {
+		case <-f.done:
+			h.text = f.text
+		default:
+			return
+		}
+	}
+
+	// Help is scrolled to flag only when it changes, so that it can be scrolled by keys
+	for _, flag := range flagCandidates(v.inputArea.text, v.inputArea.cursorByteOffset) {
+		if flag == h.flag {
+			return
+		}
+		if locs := flagIndexes(h.text, flag); len(locs) > 0 {
+			h.flag = flag
+			h.offset = bytes.Count(h.text[:locs[0]], []byte("\n"))
+			return
+		}
+	}
+	h.flag = ""
+}
+
+// fetchUsage starts getting help of command. Help is got in background when main loop can be interrupted
+// to redraw it, like output of running command, or before return otherwise.
+func (v *MainView) fetchUsage(name string) *usageFetch {
+	f := &usageFetch{done: make(chan struct{})}
+	usage := v.Pipeline().Usage(name)
+	get := func() {
+		text, err := usage()
+		if err != nil {
+			text = []byte(err.Error())
+		}
+		f.text = text
+		close(f.done)
+	}
+
+	if v.interrupt == nil {
+		get()
+		return f
+	}
+	interrupt := v.interrupt
+	go func() {
+		get()
+		interrupt()
+	}()
+	return f
+}
+
+// firstWord returns the first word of command line
+func firstWord(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 1 {
+		return ""
+	}
+	return fields[0]
+}
+
+// flagCandidates returns flags to search in help for word at or just before pos of line, best first.
+// "--key=2" gives "--key", and cluster of short flags "-nr" gives "-nr", flag under cursor and the first flag.
+func flagCandidates(line []byte, pos int) []string {
+	start, end := pos, pos
+	for start > 0 && line[start-1] != ' ' {
+		start--
+	}
+	for end < len(line) && line[end] != ' ' {
+		end++
+	}
+	word := string(line[start:end])
+	if n := strings.IndexByte(word, '='); n >= 0 {
+		word = word[:n]
+	}
+	if len(word) < 2 || word[0] != '-' || word == "--" {
+		return nil
+	}
+
+	flags := []string{word}
+	if word[1] == '-' || len(word) == 2 {
+		return flags
+	}
+	// Cursor just after the cluster is on the flag typed last
+	n := pos - start
+	if n >= len(word) {
+		n = len(word) - 1
+	}
+	if n > 1 {
+		flags = append(flags, "-"+word[n:n+1])
+	}
+	return append(flags, word[:2])
+}
+
+// flagIndexes returns offsets of flag in text, which is not a part of longer word
+func flagIndexes(text []byte, flag string) []int {
+	isWord := func(c byte) bool {
+		return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+	}
+
+	var locs []int
+	for n := 0; n < len(text); {
+		i := bytes.Index(text[n:], []byte(flag))
+		if i < 0 {
+			break
+		}
+		i += n
+		end := i + len(flag)
+		if (i == 0 || !isWord(text[i-1])) && (end == len(text) || !isWord(text[end])) {
+			locs = append(locs, i)
+		}
+		n = end
+	}
+	return locs
+}
+
+// commandHelpHeight returns height of help overlay, which covers the lower half of text area
+func (v *MainView) commandHelpHeight() int {
+	return (v.height - TextAreaPos) / 2
+}
+
+func (v *MainView) drawCommandHelp() {
+	v.updateCommandHelp()
+	h := v.commandHelp
+	if h.name == "" {
+		return
+	}
+
+	height := v.commandHelpHeight()
+	top := v.height - height
+	title := fmt.Sprintf("%s --help (PgUp/PgDn to scroll, Ctrl+U or Esc to close)", h.name)
+	if h.text == nil {
+		title = fmt.Sprintf("%s --help (getting help...)", h.name)
+	} else if h.flag != "" {
+		title = fmt.Sprintf("%s --help, %s (PgUp/PgDn to scroll, Ctrl+U or Esc to close)", h.name, h.flag)
+	}
+	drawPaneTitle(v.screen, title, 0, top, v.width)
+
+	var locs []int
+	if h.flag != "" {
+		locs = flagIndexes(h.text, h.flag)
+	}
+	lines := bytes.Split(h.text, []byte("\n"))
+	var pos int
+	for n, line := range lines {
+		y := top + 1 + n - h.offset
+		if y >= v.height {
+			break
+		}
+		start := pos
+		pos += len(line) + 1
+		if y <= top {
+			continue
+		}
+
+		var x int
+		for i, c := range string(line) {
+			fg, bg := ColFg, ColBg
+			for _, loc := range locs {
+				if start+i >= loc && start+i < loc+len(h.flag) {
+					fg, bg = termbox.ColorBlack, ColMatch
+				}
+			}
+			if c == '\t' {
+				c = ' '
+			}
+			if x+runewidth.RuneWidth(c) > v.width {
+				break
+			}
+			v.screen.SetCell(x, y, c, fg, bg)
+			x += runewidth.RuneWidth(c)
+		}
+		// Text area under overlay is hidden
+		for ; x < v.width; x++ {
+			v.screen.SetCell(x, y, ' ', ColFg, ColBg)
+		}
+	}
+	y := top + 1 + len(lines) - h.offset
+	if y <= top {
+		y = top + 1
+	}
+	for ; y < v.height; y++ {
+		for x := 0; x < v.width; x++ {
+			v.screen.SetCell(x, y, ' ', ColFg, ColBg)
+		}
+	}
+}
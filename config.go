@@ -1,16 +1,203 @@
 package main
 
-import "github.com/BurntSushi/toml"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
 
-type config struct {
-	EnableCommands []string `toml:"enable_commands"`
+	"github.com/BurntSushi/toml"
+	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// Config represents configuration file
+type Config struct {
+	EnableCommands []string                  `toml:"enable_commands"`
+	Executors      map[string]ExecutorConfig `toml:"executors"`
+	// CommandEncoding is "utf-8" to pass text converted into UTF-8 to commands,
+	// or "source" to pass original bytes and convert only for display
+	CommandEncoding string `toml:"command_encoding"`
+	// StatusTemplate is text/template of status bar, executed with StatusInfo
+	StatusTemplate string `toml:"status_template"`
+	// AcceptExitCodes are non-zero exit statuses treated as success by command name,
+	// in addition to 1 of grep unless grep is set
+	AcceptExitCodes map[string][]int  `toml:"accept_exit_codes"`
+	Environment     EnvironmentConfig `toml:"environment"`
+	// CopyOnExit is "one-liner" or "text" to copy it to clipboard on exit of interactive mode
+	CopyOnExit string `toml:"copy_on_exit"`
+	// StateDir is directory of state kept across runs, such as macros.
+	// $XDG_STATE_HOME/txtmanip or ~/.local/state/txtmanip is used when it is empty.
+	StateDir string `toml:"state_dir"`
+	// MacroKeys are keys playing macros by macro name, such as "Ctrl+]"
+	MacroKeys map[string]string `toml:"macro_keys"`
+
+	// path is file path which configuration is read from
+	path           string
+	executors      map[string]pipeline.Executor
+	statusTemplate *template.Template
+	macroKeys      map[string]termbox.Key
+}
+
+// ExecutorConfig represents executor selected for command
+type ExecutorConfig struct {
+	// Type is one of "exec", "sh", "builtin" and "isolated"
+	Type string `toml:"type"`
+	// Shell is shell path of "sh" executor, which runs the whole command line without checking commands after the first
+	Shell string `toml:"shell"`
+	// Root and Dir are root and working directory of "isolated" executor
+	Root string `toml:"root"`
+	Dir  string `toml:"dir"`
+}
+
+// EnvironmentConfig represents environment variables and working directory of commands
+type EnvironmentConfig struct {
+	Set   map[string]string `toml:"set"`
+	Unset []string          `toml:"unset"`
+	Dir   string            `toml:"dir"`
 }
 
-// GetEnableCommands returns command list specified in configuration file
-func GetEnableCommands(path string) ([]string, error) {
-	var c config
+// LoadConfig reads configuration file
+func LoadConfig(path string) (*Config, error) {
+	c := Config{path: path}
 	if _, err := toml.DecodeFile(path, &c); err != nil {
-		return []string{}, err
+		return nil, err
+	}
+
+	c.executors = make(map[string]pipeline.Executor)
+	for command, e := range c.Executors {
+		switch e.Type {
+		case "", "exec":
+			c.executors[command] = pipeline.ExecExecutor{}
+		case "sh":
+			c.executors[command] = pipeline.ShellExecutor{Path: e.Shell}
+		case "builtin":
+			if !isBuiltin(command) {
+				return nil, fmt.Errorf("executor of %s: not a built-in stage", command)
+			}
+			c.executors[command] = pipeline.BuiltinExecutor{}
+		case "isolated":
+			if e.Root == "" && e.Dir == "" {
+				return nil, fmt.Errorf("executor of %s: root or dir is required", command)
+			}
+			c.executors[command] = pipeline.IsolatedExecutor{Root: e.Root, Dir: e.Dir}
+		default:
+			return nil, fmt.Errorf("executor of %s: unknown type %q", command, e.Type)
+		}
+	}
+
+	switch c.CommandEncoding {
+	case "", "utf-8", "source":
+	default:
+		return nil, fmt.Errorf("unknown command_encoding %q", c.CommandEncoding)
+	}
+
+	switch c.CopyOnExit {
+	case "", "one-liner", "text":
+	default:
+		return nil, fmt.Errorf("unknown copy_on_exit %q", c.CopyOnExit)
+	}
+
+	c.macroKeys = make(map[string]termbox.Key)
+	for name, key := range c.MacroKeys {
+		k, err := keyByName(key)
+		if err != nil {
+			return nil, fmt.Errorf("key of macro %s: %s", name, err.Error())
+		}
+		for _, a := range defaultKeymap() {
+			for _, bound := range a.Keys {
+				if bound == k {
+					return nil, fmt.Errorf("key of macro %s: %s is bound to %s", name, key, a.Name)
+				}
+			}
+		}
+		c.macroKeys[name] = k
+	}
+
+	if c.StatusTemplate == "" {
+		c.StatusTemplate = DefaultStatusTemplate
+	}
+	t, err := template.New("status").Parse(c.StatusTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("status_template: %s", err.Error())
+	}
+	c.statusTemplate = t
+	return &c, nil
+}
+
+// MacroPath returns path of macro file in state directory
+func (c *Config) MacroPath() string {
+	dir := c.StateDir
+	if dir == "" {
+		dir = DefaultStateDir()
+	}
+	return filepath.Join(dir, MacroFile)
+}
+
+// DefaultStateDir returns $XDG_STATE_HOME/txtmanip, or ~/.local/state/txtmanip.
+// Current directory is used when home directory is unknown.
+func DefaultStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, Name)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(home, ".local", "state", Name)
+}
+
+// isBuiltin reports whether command is name of built-in stage
+func isBuiltin(command string) bool {
+	for _, name := range pipeline.Builtins() {
+		if command == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadSource returns source of text in encoding, which is detected when encoding is empty.
+// displayEncoding is set when text is passed to commands as is but has to be converted for display.
+// Text which cannot be converted is passed as is, and warn tells it.
+func (c *Config) LoadSource(name string, text []byte, encoding string) (source pipeline.Source, displayEncoding string, warn string) {
+	if encoding == "" {
+		// Binary is passed as is, since it is shown by hex view
+		if IsBinary(text) {
+			return pipeline.Source{Name: name, Text: text}, "", ""
+		}
+		encoding = pipeline.DetectEncoding(text)
+	}
+	if pipeline.IsUTF8(encoding) {
+		return pipeline.Source{Name: name, Text: text}, "", ""
+	}
+	if c.CommandEncoding == "source" {
+		return pipeline.Source{Name: name, Text: text}, encoding, ""
+	}
+
+	converted, err := pipeline.ConvertToUTF8(text, encoding, false)
+	if err != nil {
+		return pipeline.Source{Name: name, Text: text}, "",
+			fmt.Sprintf("convert %s from %s failed, so that text is used as is: %s", displaySourceName(name), encoding, err.Error())
+	}
+	return pipeline.Source{Name: name, Text: converted, Encoding: encoding}, "", ""
+}
+
+// displaySourceName returns file name of source for message
+func displaySourceName(name string) string {
+	if name == "" {
+		return "<stdin>"
+	}
+	return name
+}
+
+// NewPipeline returns pipeline of source with enabled commands and executors of configuration
+func (c *Config) NewPipeline(source pipeline.Source) *pipeline.Pipeline {
+	p := pipeline.New(source, &pipeline.Policy{EnableCommands: c.EnableCommands})
+	p.Executors = c.executors
+	p.Env = pipeline.Environment{Set: c.Environment.Set, Unset: c.Environment.Unset, Dir: c.Environment.Dir}.Copy()
+	for command, codes := range c.AcceptExitCodes {
+		p.AcceptCodes[command] = codes
 	}
-	return c.EnableCommands, nil
+	return p
 }
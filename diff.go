@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+const (
+	// diffMaxLines is max number of lines of each text compared by diff
+	diffMaxLines = 200000
+	// diffContext is number of unchanged lines shown around changes
+	diffContext = 3
+)
+
+// diffLines returns which lines of a are deleted and which lines of b are inserted to make b from a.
+// It finds shortest edit script by bisecting middle snakes of Myers' algorithm, which uses linear space.
+func diffLines(a, b [][]byte) (deleted, inserted []bool) {
+	// Lines are compared by id
+	ids := make(map[string]int)
+	id := func(lines [][]byte) []int {
+		r := make([]int, len(lines))
+		for n, l := range lines {
+			i, ok := ids[string(l)]
+			if !ok {
+				i = len(ids)
+				ids[string(l)] = i
+			}
+			r[n] = i
+		}
+		return r
+	}
+	d := &differ{a: id(a), b: id(b), deleted: make([]bool, len(a)), inserted: make([]bool, len(b))}
+	d.compare(0, len(a), 0, len(b))
+	return d.deleted, d.inserted
+}
+
+type differ struct {
+	a, b              []int
+	deleted, inserted []bool
+}
+
+// compare marks edits between a[a0:a1] and b[b0:b1]
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		a0, b0 = a0+1, b0+1
+	}
+	for a0 < a1 && b0 < b1 && d.a[a1-1] == d.b[b1-1] {
+		a1, b1 = a1-1, b1-1
+	}
+	if a0 == a1 || b0 == b1 {
+		for i := a0; i < a1; i++ {
+			d.deleted[i] = true
+		}
+		for j := b0; j < b1; j++ {
+			d.inserted[j] = true
+		}
+		return
+	}
+
+	x, y := d.bisect(a0, a1, b0, b1)
+	d.compare(a0, x, b0, y)
+	d.compare(x, a1, y, b1)
+}
+
+// bisect returns point where middle snake of a[a0:a1] and b[b0:b1] is found by searching from both ends
+func (d *differ) bisect(a0, a1, b0, b1 int) (int, int) {
+	a, b := d.a[a0:a1], d.b[b0:b1]
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	offset := max
+	v1 := make([]int, 2*max+2)
+	v2 := make([]int, 2*max+2)
+	for i := range v1 {
+		v1[i], v2[i] = -1, -1
+	}
+	v1[offset+1], v2[offset+1] = 0, 0
+	delta := n - m
+	// Paths from both ends overlap on forward search when delta is odd
+	front := delta%2 != 0
+	var k1start, k1end, k2start, k2end int
+
+	for e := 0; e < max; e++ {
+		for k1 := -e + k1start; k1 <= e-k1end; k1 += 2 {
+			i := offset + k1
+			var x1 int
+			if k1 == -e || (k1 != e && v1[i-1] < v1[i+1]) {
+				x1 = v1[i+1]
+			} else {
+				x1 = v1[i-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && a[x1] == b[y1] {
+				x1, y1 = x1+1, y1+1
+			}
+			v1[i] = x1
+			switch {
+			case x1 > n:
+				k1end += 2
+			case y1 > m:
+				k1start += 2
+			case front:
+				j := offset + delta - k1
+				if j >= 0 && j < len(v2) && v2[j] != -1 && x1 >= n-v2[j] {
+					return a0 + x1, b0 + y1
+				}
+			}
+		}
+
+		for k2 := -e + k2start; k2 <= e-k2end; k2 += 2 {
+			j := offset + k2
+			var x2 int
+			if k2 == -e || (k2 != e && v2[j-1] < v2[j+1]) {
+				x2 = v2[j+1]
+			} else {
+				x2 = v2[j-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && a[n-x2-1] == b[m-y2-1] {
+				x2, y2 = x2+1, y2+1
+			}
+			v2[j] = x2
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				i := offset + delta - k2
+				if i >= 0 && i < len(v1) && v1[i] != -1 {
+					x1 := v1[i]
+					y1 := offset + x1 - i
+					if x1 >= n-x2 {
+						return a0 + x1, b0 + y1
+					}
+				}
+			}
+		}
+	}
+	// No common line
+	return a1, b0
+}
+
+// splitLines returns lines of text without newlines
+func splitLines(text []byte) [][]byte {
+	if len(text) < 1 {
+		return nil
+	}
+	return bytes.Split(bytes.TrimSuffix(text, []byte("\n")), []byte("\n"))
+}
+
+// DiffView represent unified diff between two texts
+type DiffView struct {
+	// lines are lines of diff starting with "-", "+", " " or "@@"
+	lines   []string
+	added   int
+	removed int
+}
+
+// NewDiffView returns unified diff from text a titled aTitle to text b titled bTitle
+func NewDiffView(a, b []byte, aTitle, bTitle string) (*DiffView, error) {
+	al, bl := splitLines(a), splitLines(b)
+	if len(al) > diffMaxLines || len(bl) > diffMaxLines {
+		return nil, fmt.Errorf("text of more than %d lines cannot be compared", diffMaxLines)
+	}
+	deleted, inserted := diffLines(al, bl)
+
+	v := &DiffView{lines: []string{"--- " + aTitle, "+++ " + bTitle}}
+	// Each edit line is paired with position of unchanged lines from both texts
+	type line struct {
+		text string
+		i, j int
+	}
+	var all []line
+	for i, j := 0, 0; i < len(al) || j < len(bl); {
+		switch {
+		case i < len(al) && deleted[i]:
+			all = append(all, line{"-" + string(al[i]), i, j})
+			v.removed++
+			i++
+		case j < len(bl) && inserted[j]:
+			all = append(all, line{"+" + string(bl[j]), i, j})
+			v.added++
+			j++
+		default:
+			all = append(all, line{" " + string(al[i]), i, j})
+			i, j = i+1, j+1
+		}
+	}
+
+	// Group changes with context lines into hunks
+	for n := 0; n < len(all); {
+		if all[n].text[0] == ' ' {
+			n++
+			continue
+		}
+		start := n - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := n
+		for k := n; k < len(all) && k <= end+2*diffContext; k++ {
+			if all[k].text[0] != ' ' {
+				end = k
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(all) {
+			stop = len(all)
+		}
+
+		var aLen, bLen int
+		for _, l := range all[start:stop] {
+			if l.text[0] != '+' {
+				aLen++
+			}
+			if l.text[0] != '-' {
+				bLen++
+			}
+		}
+		v.lines = append(v.lines, fmt.Sprintf("@@ -%d,%d +%d,%d @@", all[start].i+1, aLen, all[start].j+1, bLen))
+		for _, l := range all[start:stop] {
+			v.lines = append(v.lines, l.text)
+		}
+		n = stop
+	}
+	if v.added == 0 && v.removed == 0 {
+		return nil, errors.New("no difference")
+	}
+	return v, nil
+}
+
+// Summary returns number of removed and added lines
+func (v *DiffView) Summary() string {
+	return fmt.Sprintf("%d lines removed, %d lines added", v.removed, v.added)
+}
+
+func (v *DiffView) draw(s Screen, x0, y0, width, height, offset int) {
+	for y, n := y0, offset; y < y0+height && n < len(v.lines); y, n = y+1, n+1 {
+		fg := ColFg
+		switch l := v.lines[n]; {
+		case n < 2:
+			fg |= termbox.AttrBold
+		case len(l) > 1 && l[:2] == "@@":
+			fg = termbox.ColorCyan
+		case l[0] == '-':
+			fg = termbox.ColorRed
+		case l[0] == '+':
+			fg = termbox.ColorGreen
+		}
+
+		var x int
+		for _, c := range v.lines[n] {
+			if x+runewidth.RuneWidth(c) > width {
+				break
+			}
+			s.SetCell(x0+x, y, c, fg, ColBg)
+			x += runewidth.RuneWidth(c)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// HelpView represent overlay of key bindings, allowed commands and configuration file
+type HelpView struct {
+	text   []byte
+	offset int
+}
+
+// ToggleHelp opens or closes help overlay
+func (v *MainView) ToggleHelp() {
+	if v.help != nil {
+		v.help = nil
+		return
+	}
+
+	lines := []string{fmt.Sprint("Configuration: ", v.configPath), fmt.Sprint("Macros: ", v.macroPath), "", "Keys:"}
+	for _, a := range v.keymap {
+		lines = append(lines, fmt.Sprintf("  %-22s %-18s %s", a.KeyNames(), a.Name, a.Description))
+	}
+	lines = append(lines, "", "Enabled commands:", "  "+strings.Join(v.enableCommands, " "))
+	var stages []string
+	for _, name := range pipeline.Builtins() {
+		stages = append(stages, pipeline.BuiltinPrefix+name)
+	}
+	lines = append(lines, "", "Built-in stages:", "  "+strings.Join(stages, " "))
+	v.help = &HelpView{text: []byte(strings.Join(lines, "\n"))}
+}
+
+// HandleHelpKey handles key for help overlay, and reports whether key is consumed.
+// Keys other than scroll and close are ignored while help is shown.
+func (v *MainView) HandleHelpKey(ev termbox.Event) bool {
+	h := v.help
+	switch ev.Key {
+	case termbox.KeyArrowUp:
+		h.offset--
+	case termbox.KeyArrowDown:
+		h.offset++
+	case termbox.KeyPgup:
+		h.offset -= (v.height - TextAreaPos) / 2
+	case termbox.KeyPgdn:
+		h.offset += (v.height - TextAreaPos) / 2
+	case termbox.KeyF1, termbox.KeyEsc:
+		v.help = nil
+		return true
+	}
+	if max := NewLineIndex(h.text).Len() - 1; h.offset > max {
+		h.offset = max
+	}
+	if h.offset < 0 {
+		h.offset = 0
+	}
+	return true
+}
+
+func (v *MainView) drawHelp() {
+	drawPaneTitle(v.screen, "help (Up/Down or PgUp/PgDn to scroll, F1 or Esc to close)", 0, TextAreaPos, v.width)
+	drawTextBox(v.screen, v.help.text, 0, TextAreaPos+1, v.width, v.height-TextAreaPos-1, v.help.offset, true)
+}
+
+// CommandPalette represent actions filtered by fuzzy query typed in input area
+type CommandPalette struct {
+	// input is text of input area before palette was opened, which is restored when palette is closed
+	input  []byte
+	cursor int
+}
+
+// OpenPalette opens command palette, using input area for query
+func (v *MainView) OpenPalette() {
+	v.palette = &CommandPalette{input: append([]byte{}, v.inputArea.text...)}
+	v.ClearInputText()
+}
+
+// closePalette closes command palette and restores text of input area
+func (v *MainView) closePalette() {
+	v.inputArea.text = v.palette.input
+	v.palette = nil
+	v.EndCursor()
+}
+
+// paletteActions returns actions matching query in input area, best match first
+func (v *MainView) paletteActions() []*Action {
+	query := string(v.inputArea.text)
+	type match struct {
+		action *Action
+		score  int
+	}
+	var matches []match
+	for n := range v.keymap {
+		a := &v.keymap[n]
+		score, ok := fuzzyScore(query, a.Name)
+		// Name matches rank above description matches
+		score *= 2
+		if s, found := fuzzyScore(query, a.Description); found && (!ok || s > score) {
+			score, ok = s, true
+		}
+		if ok {
+			matches = append(matches, match{a, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	var actions []*Action
+	for _, m := range matches {
+		actions = append(actions, m.action)
+	}
+	return actions
+}
+
+// fuzzyScore reports whether runes of pattern appear in s in order ignoring case, and scores the match.
+// Consecutive runes and runes at start of words score higher.
+func fuzzyScore(pattern, s string) (int, bool) {
+	p := []rune(strings.ToLower(pattern))
+	r := []rune(strings.ToLower(s))
+	var score, i int
+	prev := -2
+	for n := 0; n < len(r) && i < len(p); n++ {
+		if r[n] != p[i] {
+			continue
+		}
+		score++
+		if n == prev+1 {
+			score += 2
+		}
+		if n == 0 || strings.ContainsRune(" -_", r[n-1]) {
+			score += 3
+		}
+		prev = n
+		i++
+	}
+	return score, i == len(p)
+}
+
+// HandlePaletteKey handles key for command palette. It returns action selected to run, and whether key is consumed.
+// Keys editing query are left to main loop, and other keys are ignored.
+func (v *MainView) HandlePaletteKey(ev termbox.Event) (*Action, bool) {
+	p := v.palette
+	switch ev.Key {
+	case termbox.KeyArrowUp:
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case termbox.KeyArrowDown:
+		p.cursor++
+	case termbox.KeyEnter:
+		actions := v.paletteActions()
+		v.closePalette()
+		if p.cursor < len(actions) {
+			return actions[p.cursor], true
+		}
+	case termbox.KeyEsc, termbox.KeyCtrlQ:
+		v.closePalette()
+	case termbox.KeySpace, termbox.KeyBackspace, termbox.KeyBackspace2, termbox.KeyDelete, termbox.KeyCtrlD,
+		termbox.KeyArrowLeft, termbox.KeyArrowRight, termbox.KeyCtrlA, termbox.KeyCtrlE, termbox.KeyCtrlB, termbox.KeyCtrlF:
+		p.cursor = 0
+		return nil, false
+	default:
+		if ev.Ch != 0 {
+			p.cursor = 0
+			return nil, false
+		}
+	}
+	if n := len(v.paletteActions()); p.cursor >= n {
+		p.cursor = n - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+	return nil, true
+}
+
+func (v *MainView) drawPalette() {
+	drawPaneTitle(v.screen, "command palette (type to filter, Up/Down to select, Enter to run, Esc to close)", 0, TextAreaPos, v.width)
+
+	for n, a := range v.paletteActions() {
+		y := TextAreaPos + 1 + n
+		if y >= v.height {
+			return
+		}
+		fg := ColFg
+		if n == v.palette.cursor {
+			fg |= termbox.AttrReverse
+		}
+		var x int
+		for _, c := range fmt.Sprintf("%-18s %-22s %s", a.Name, a.KeyNames(), a.Description) {
+			if x+runewidth.RuneWidth(c) > v.width {
+				break
+			}
+			v.screen.SetCell(x, y, c, fg, ColBg)
+			x += runewidth.RuneWidth(c)
+		}
+	}
+}
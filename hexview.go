@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// binarySampleSize is number of bytes used for detecting binary
+const binarySampleSize = 8000
+
+// IsBinary reports whether text looks like binary, which contains NUL or many control characters
+func IsBinary(text []byte) bool {
+	if len(text) > binarySampleSize {
+		text = text[:binarySampleSize]
+	}
+	if bytes.IndexByte(text, 0) >= 0 {
+		return true
+	}
+
+	var control int
+	for _, c := range text {
+		if c < 0x20 && !strings.ContainsRune("\t\n\v\f\r\x1b", rune(c)) || c == 0x7f {
+			control++
+		}
+	}
+	return control*10 > len(text)
+}
+
+// HexView represent hexdump of raw bytes with offset column, hex bytes and ASCII gutter
+type HexView struct {
+	data    []byte
+	pattern []byte
+	// matches are offsets of pattern in data
+	matches []int
+	// match is index of current match, or -1
+	match int
+}
+
+// NewHexView returns hex view of data
+func NewHexView(data []byte) *HexView {
+	return &HexView{data: data, match: -1}
+}
+
+// hexBytesPerRow returns number of bytes in a row fitting width
+func hexBytesPerRow(width int) int {
+	// "00000000  " + "xx " per byte + extra space per 8 bytes + "|" + ASCII + "|"
+	if width >= 10+16*3+2+18 {
+		return 16
+	}
+	return 8
+}
+
+// Rows returns number of rows for width
+func (h *HexView) Rows(width int) int {
+	n := hexBytesPerRow(width)
+	return (len(h.data) + n - 1) / n
+}
+
+// ToggleHexView switches text area between hexdump of raw bytes and text
+func (v *MainView) ToggleHexView() {
+	if v.hexView != nil {
+		v.hexView = nil
+		return
+	}
+	v.hexView = NewHexView(v.Pipeline().Text())
+	v.textArea.offset = 0
+}
+
+// refreshHexView switches hex view when text becomes binary or not, and updates data of hex view.
+// Hex view toggled by hand is kept until text changes between binary and not.
+func (v *MainView) refreshHexView() {
+	text := v.Pipeline().Text()
+	binary := IsBinary(text)
+	if binary != v.binary {
+		v.binary = binary
+		v.hexView = nil
+		if binary {
+			v.hexView = NewHexView(text)
+			v.textArea.offset = 0
+		}
+		return
+	}
+	if v.hexView != nil {
+		pattern := v.hexView.pattern
+		v.hexView = NewHexView(text)
+		v.hexView.setPattern(pattern)
+	}
+}
+
+// parseHexPattern returns bytes searched for pattern.
+// Pattern starting with "0x" is hex bytes, and spaces between them are ignored.
+func parseHexPattern(p string) ([]byte, error) {
+	if p == "" {
+		return nil, errors.New("type text or 0x-prefixed hex bytes to search")
+	}
+	if !strings.HasPrefix(p, "0x") {
+		return []byte(p), nil
+	}
+	b, err := hex.DecodeString(strings.Replace(p[2:], " ", "", -1))
+	if err != nil || len(b) < 1 {
+		return nil, fmt.Errorf("invalid hex bytes: %s", p)
+	}
+	return b, nil
+}
+
+func (h *HexView) setPattern(pattern []byte) {
+	h.pattern, h.matches, h.match = pattern, nil, -1
+	if len(pattern) < 1 {
+		return
+	}
+	for i := 0; i < len(h.data); {
+		n := bytes.Index(h.data[i:], pattern)
+		if n < 0 {
+			break
+		}
+		h.matches = append(h.matches, i+n)
+		i += n + 1
+	}
+}
+
+// SearchHex moves to next (dir is 1) or previous (dir is -1) match of pattern in input area, and returns its message
+func (v *MainView) SearchHex(dir int) (string, error) {
+	h := v.hexView
+	pattern, err := parseHexPattern(string(v.inputArea.text))
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(pattern, h.pattern) {
+		h.setPattern(pattern)
+	}
+	if len(h.matches) < 1 {
+		return "", errors.New("no match")
+	}
+
+	switch {
+	case h.match < 0 && dir > 0:
+		h.match = 0
+	case h.match < 0:
+		h.match = len(h.matches) - 1
+	default:
+		h.match = (h.match + dir + len(h.matches)) % len(h.matches)
+	}
+
+	// Scroll so that row of the match is visible
+	row := h.matches[h.match] / hexBytesPerRow(v.width)
+	height := v.height - TextAreaPos
+	if row < v.textArea.offset || row >= v.textArea.offset+height {
+		v.textArea.offset = row - height/2
+		if v.textArea.offset < 0 {
+			v.textArea.offset = 0
+		}
+	}
+	return fmt.Sprintf("match %d/%d at 0x%08x", h.match+1, len(h.matches), h.matches[h.match]), nil
+}
+
+// matched returns whether byte at offset i is in match, and whether it is in current match.
+// Matches are sorted, so that the last match starting at or before i is enough to be checked.
+func (h *HexView) matched(i int) (bool, bool) {
+	n := sort.SearchInts(h.matches, i+1) - 1
+	if n < 0 || i >= h.matches[n]+len(h.pattern) {
+		return false, false
+	}
+	if h.match < 0 {
+		return true, false
+	}
+	m := h.matches[h.match]
+	return true, m <= i && i < m+len(h.pattern)
+}
+
+func (h *HexView) draw(s Screen, x0, y0, width, height, offset int) {
+	perRow := hexBytesPerRow(width)
+	ascii := x0 + 10 + perRow*3 + perRow/8
+
+	for y, row := y0, offset; y < y0+height && row*perRow < len(h.data); y, row = y+1, row+1 {
+		start := row * perRow
+		var x int
+		for _, c := range fmt.Sprintf("%08x  ", start) {
+			s.SetCell(x0+x, y, c, termbox.ColorCyan, ColBg)
+			x++
+		}
+
+		s.SetCell(ascii, y, '|', ColFg, ColBg)
+		for i := start; i < start+perRow && i < len(h.data); i++ {
+			b := h.data[i]
+			fg, bg := ColFg, ColBg
+			if in, current := h.matched(i); current {
+				fg, bg = termbox.ColorBlack, ColMatch
+			} else if in {
+				fg = ColFg | termbox.AttrReverse
+			}
+
+			for _, c := range fmt.Sprintf("%02x", b) {
+				s.SetCell(x0+x, y, c, fg, bg)
+				x++
+			}
+			x++
+			if (i-start)%8 == 7 {
+				x++
+			}
+
+			c := rune('.')
+			if b >= 0x20 && b < 0x7f {
+				c = rune(b)
+			}
+			s.SetCell(ascii+1+i-start, y, c, fg, bg)
+		}
+		s.SetCell(ascii+1+perRow, y, '|', ColFg, ColBg)
+	}
+}
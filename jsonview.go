@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// jsonNode represent JSON value in tree
+type jsonNode struct {
+	// label is key of object member or empty
+	label    string
+	path     string
+	raw      json.RawMessage
+	children []*jsonNode
+	folded   bool
+	// root is index of JSON value in JSON Lines
+	root int
+}
+
+func (n *jsonNode) isContainer() bool {
+	c := pipeline.FirstByte(n.raw)
+	return c == '{' || c == '['
+}
+
+// jsonLine represent line of pretty-printed tree
+type jsonLine struct {
+	node    *jsonNode
+	depth   int
+	closing bool
+	last    bool
+}
+
+// JSONView represent foldable tree of JSON or JSON Lines
+type JSONView struct {
+	roots  []*jsonNode
+	lines  []jsonLine
+	cursor int
+}
+
+// ParseJSONView parses text as JSON or JSON Lines
+func ParseJSONView(text []byte) (*JSONView, error) {
+	values, err := pipeline.DecodeJSONValues(text)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &JSONView{}
+	for n, v := range values {
+		root, err := newJSONNode("", ".", v)
+		if err != nil {
+			return nil, err
+		}
+		root.root = n
+		j.roots = append(j.roots, root)
+	}
+	j.layout()
+	return j, nil
+}
+
+func newJSONNode(label, path string, raw json.RawMessage) (*jsonNode, error) {
+	n := &jsonNode{label: label, path: path, raw: raw}
+
+	switch pipeline.FirstByte(raw) {
+	case '{':
+		members, err := pipeline.ObjectMembers(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			child, err := newJSONNode(strconv.Quote(m.Key), joinPath(path, pipeline.PathKey(m.Key)), m.Value)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, child)
+		}
+	case '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, err
+		}
+		for i, e := range elems {
+			child, err := newJSONNode("", joinPath(path, fmt.Sprintf("[%d]", i)), e)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, child)
+		}
+	}
+	return n, nil
+}
+
+func joinPath(path, step string) string {
+	if path == "." {
+		if strings.HasPrefix(step, ".") {
+			return step
+		}
+		return "." + step
+	}
+	return path + step
+}
+
+// layout flattens visible nodes into lines
+func (j *JSONView) layout() {
+	j.lines = j.lines[:0]
+
+	var walk func(n *jsonNode, depth int, last bool)
+	walk = func(n *jsonNode, depth int, last bool) {
+		j.lines = append(j.lines, jsonLine{node: n, depth: depth, last: last})
+		if !n.isContainer() || n.folded || len(n.children) < 1 {
+			return
+		}
+		for i, c := range n.children {
+			walk(c, depth+1, i == len(n.children)-1)
+		}
+		j.lines = append(j.lines, jsonLine{node: n, depth: depth, closing: true, last: last})
+	}
+	for _, r := range j.roots {
+		walk(r, 0, true)
+	}
+
+	if j.cursor >= len(j.lines) {
+		j.cursor = len(j.lines) - 1
+	}
+}
+
+// text returns pretty-printed line
+func (l jsonLine) text() string {
+	var b strings.Builder
+	b.WriteString(strings.Repeat("  ", l.depth))
+
+	open, end := pipeline.FirstByte(l.node.raw), byte(0)
+	switch open {
+	case '{':
+		end = '}'
+	case '[':
+		end = ']'
+	}
+
+	switch {
+	case l.closing:
+		b.WriteByte(end)
+	default:
+		if l.node.label != "" {
+			b.WriteString(l.node.label)
+			b.WriteString(": ")
+		}
+		switch {
+		case end == 0:
+			b.Write(l.node.raw)
+		case len(l.node.children) < 1:
+			b.WriteByte(open)
+			b.WriteByte(end)
+		case l.node.folded:
+			fmt.Fprintf(&b, "%c...%c (%d)", open, end, len(l.node.children))
+		default:
+			b.WriteByte(open)
+			return b.String()
+		}
+	}
+	if !l.last {
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// Breadcrumb returns path of node under cursor
+func (j *JSONView) Breadcrumb() string {
+	if len(j.lines) < 1 {
+		return ""
+	}
+	n := j.lines[j.cursor].node
+	if len(j.roots) > 1 {
+		return fmt.Sprintf("line %d: %s", n.root+1, n.path)
+	}
+	return n.path
+}
+
+// PathUnderCursor returns path of node under cursor
+func (j *JSONView) PathUnderCursor() string {
+	return j.lines[j.cursor].node.path
+}
+
+// ToggleFold folds or unfolds node under cursor
+func (j *JSONView) ToggleFold() {
+	n := j.lines[j.cursor].node
+	if !n.isContainer() {
+		return
+	}
+	n.folded = !n.folded
+
+	// Keep cursor on the opening line of folded node
+	if j.lines[j.cursor].closing {
+		for i := j.cursor; i >= 0; i-- {
+			if j.lines[i].node == n && !j.lines[i].closing {
+				j.cursor = i
+				break
+			}
+		}
+	}
+	j.layout()
+}
+
+// MoveCursor moves cursor by n lines
+func (j *JSONView) MoveCursor(n int) {
+	j.cursor += n
+	if j.cursor >= len(j.lines) {
+		j.cursor = len(j.lines) - 1
+	}
+	if j.cursor < 0 {
+		j.cursor = 0
+	}
+}
+
+// draw updates back buffer for breadcrumb and tree, scrolling offset so that cursor is visible
+func (j *JSONView) draw(s Screen, x0, y0, width, height int, offset *int) {
+	drawPaneTitle(s, j.Breadcrumb(), x0, y0, width)
+
+	rows := height - 1
+	if j.cursor < *offset {
+		*offset = j.cursor
+	}
+	if j.cursor >= *offset+rows {
+		*offset = j.cursor - rows + 1
+	}
+
+	for y, n := y0+1, *offset; y < y0+height && n < len(j.lines); y, n = y+1, n+1 {
+		fg := ColFg
+		if n == j.cursor {
+			fg |= termbox.AttrReverse
+		}
+		x := 0
+		for _, c := range j.lines[n].text() {
+			if x+runewidth.RuneWidth(c) > width {
+				break
+			}
+			s.SetCell(x0+x, y, c, fg, ColBg)
+			x += runewidth.RuneWidth(c)
+		}
+	}
+}
+
+// PathStage returns stage applying path under cursor.
+// jq is used when it is enabled, otherwise built-in path stage is used.
+func (j *JSONView) PathStage(enableCommands []string) string {
+	path := pipeline.ShellQuote(j.PathUnderCursor())
+	for _, c := range enableCommands {
+		if c == "jq" {
+			return "jq " + path
+		}
+	}
+	return pipeline.BuiltinPrefix + "path " + path
+}
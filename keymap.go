@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// errQuit is returned by action to quit interactive mode
+var errQuit = errors.New("quit")
+
+// Action represent UI action bound to keys, which can also be run by name from command palette
+type Action struct {
+	Name        string
+	Keys        []termbox.Key
+	Description string
+	// Run performs action. Returned error is shown in input area, except errQuit which ends main loop.
+	Run func(v *MainView) error
+}
+
+// KeyNames returns names of keys of action, such as "Ctrl+C, Esc"
+func (a Action) KeyNames() string {
+	var names []string
+	for _, k := range a.Keys {
+		// Keys sent differently by terminals have the same name
+		if name := keyName(k); len(names) < 1 || names[len(names)-1] != name {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// keyName returns name of key, such as "Ctrl+Z" and "F1"
+func keyName(k termbox.Key) string {
+	switch k {
+	case termbox.KeyEnter:
+		return "Enter"
+	case termbox.KeyEsc:
+		return "Esc"
+	case termbox.KeyTab:
+		return "Tab"
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		return "Backspace"
+	case termbox.KeySpace:
+		return "Space"
+	case termbox.KeyInsert:
+		return "Insert"
+	case termbox.KeyDelete:
+		return "Delete"
+	case termbox.KeyHome:
+		return "Home"
+	case termbox.KeyEnd:
+		return "End"
+	case termbox.KeyPgup:
+		return "PgUp"
+	case termbox.KeyPgdn:
+		return "PgDn"
+	case termbox.KeyArrowUp:
+		return "Up"
+	case termbox.KeyArrowDown:
+		return "Down"
+	case termbox.KeyArrowLeft:
+		return "Left"
+	case termbox.KeyArrowRight:
+		return "Right"
+	case termbox.KeyCtrlSpace:
+		return "Ctrl+Space"
+	case termbox.KeyCtrlBackslash:
+		return `Ctrl+\`
+	case termbox.KeyCtrlRsqBracket:
+		return "Ctrl+]"
+	case termbox.KeyCtrl6:
+		return "Ctrl+^"
+	case termbox.KeyCtrlSlash:
+		return "Ctrl+_"
+	}
+	if k >= termbox.KeyF12 && k <= termbox.KeyF1 {
+		return fmt.Sprintf("F%d", termbox.KeyF1-k+1)
+	}
+	if k >= termbox.KeyCtrlA && k <= termbox.KeyCtrlZ {
+		return fmt.Sprintf("Ctrl+%c", 'A'+rune(k-termbox.KeyCtrlA))
+	}
+	return fmt.Sprintf("key 0x%04x", uint16(k))
+}
+
+// keyByName returns key of name returned by keyName
+func keyByName(name string) (termbox.Key, error) {
+	for k := termbox.Key(0); k <= termbox.KeySpace; k++ {
+		if keyName(k) == name {
+			return k, nil
+		}
+	}
+	for k := termbox.KeyF1; k >= termbox.KeyArrowRight; k-- {
+		if keyName(k) == name {
+			return k, nil
+		}
+	}
+	if keyName(termbox.KeyBackspace2) == name {
+		return termbox.KeyBackspace2, nil
+	}
+	return 0, fmt.Errorf("unknown key %q", name)
+}
+
+// lookupAction returns action bound to key, or nil
+func (v *MainView) lookupAction(k termbox.Key) *Action {
+	for n := range v.keymap {
+		for _, key := range v.keymap[n].Keys {
+			if key == k {
+				return &v.keymap[n]
+			}
+		}
+	}
+	return nil
+}
+
+// runAction runs action and shows its error. It reports whether interactive mode ends.
+func (v *MainView) runAction(a *Action) bool {
+	err := a.Run(v)
+	if err == nil {
+		return false
+	}
+	if err == errQuit {
+		return true
+	}
+	v.stopMacro()
+	v.InputError(err.Error())
+	return false
+}
+
+// message returns action which shows message returned by f
+func message(f func(v *MainView) (string, error)) func(v *MainView) error {
+	return func(v *MainView) error {
+		m, err := f(v)
+		if err != nil {
+			return err
+		}
+		v.InputError(m)
+		return nil
+	}
+}
+
+// inputMessage returns action which passes text of input area to f, and clears it when f succeeds
+func inputMessage(f func(v *MainView, input string) (string, error)) func(v *MainView) error {
+	return func(v *MainView) error {
+		m, err := f(v, string(v.inputArea.text))
+		if err != nil {
+			return err
+		}
+		v.ClearInputText()
+		v.InputError(m)
+		return nil
+	}
+}
+
+// defaultKeymap returns key bindings of interactive mode, in order shown by help
+func defaultKeymap() []Action {
+	return []Action{
+		{"help", []termbox.Key{termbox.KeyF1}, "Toggle help of keys, enabled commands and configuration file", func(v *MainView) error {
+			v.ToggleHelp()
+			return nil
+		}},
+		{"palette", []termbox.Key{termbox.KeyCtrlQ}, "Open command palette to run action by name", func(v *MainView) error {
+			v.OpenPalette()
+			return nil
+		}},
+		{"command-help", []termbox.Key{termbox.KeyCtrlU}, "Toggle --help of command being typed, highlighting flag under cursor", func(v *MainView) error {
+			v.ToggleCommandHelp()
+			return nil
+		}},
+		{"quit", []termbox.Key{termbox.KeyCtrlC, termbox.KeyEsc}, "Quit interactive mode, or cancel running command", func(v *MainView) error {
+			return errQuit
+		}},
+		{"run", []termbox.Key{termbox.KeyEnter}, "Invoke command typed, or accept text in filter mode when input is empty", (*MainView).runInput},
+		{"run-all-buffers", []termbox.Key{termbox.KeyCtrlX}, "Invoke command typed on every buffer", func(v *MainView) error {
+			if len(v.inputArea.text) < 1 {
+				return nil
+			}
+			if errs := v.ApplyToAllBuffers(string(v.inputArea.text)); len(errs) > 0 {
+				v.InputError(strings.Join(errs, ", "))
+			}
+			v.SaveInputHistory()
+			v.ClearInputText()
+			return nil
+		}},
+		{"undo", []termbox.Key{termbox.KeyCtrlZ}, "Undo last stage", func(v *MainView) error {
+			v.Undo()
+			return nil
+		}},
+		{"redo", []termbox.Key{termbox.KeyCtrlY}, "Redo stage reverted by undo", func(v *MainView) error {
+			v.Redo()
+			return nil
+		}},
+		{"history-previous", []termbox.Key{termbox.KeyArrowUp}, "Print previous command of history", func(v *MainView) error {
+			v.BackwardInputHistory()
+			v.DrawInputHistory()
+			return nil
+		}},
+		{"history-next", []termbox.Key{termbox.KeyArrowDown}, "Print next command of history", func(v *MainView) error {
+			v.ForwardInputHistory()
+			v.DrawInputHistory()
+			return nil
+		}},
+		{"cursor-start", []termbox.Key{termbox.KeyCtrlA}, "Move cursor to start of input", func(v *MainView) error {
+			v.InitCursor()
+			return nil
+		}},
+		{"cursor-end", []termbox.Key{termbox.KeyCtrlE}, "Move cursor to end of input", func(v *MainView) error {
+			v.EndCursor()
+			return nil
+		}},
+		{"cursor-backward", []termbox.Key{termbox.KeyArrowLeft, termbox.KeyCtrlB}, "Move cursor backward", func(v *MainView) error {
+			v.BackwardCursor()
+			return nil
+		}},
+		{"cursor-forward", []termbox.Key{termbox.KeyArrowRight, termbox.KeyCtrlF}, "Move cursor forward", func(v *MainView) error {
+			v.ForwardOneRuneCursor()
+			return nil
+		}},
+		{"delete-backward", []termbox.Key{termbox.KeyBackspace, termbox.KeyBackspace2}, "Delete character before cursor", func(v *MainView) error {
+			v.BackwardCursor()
+			v.DeleteInputText()
+			return nil
+		}},
+		{"delete", []termbox.Key{termbox.KeyDelete, termbox.KeyCtrlD}, "Delete character at cursor", func(v *MainView) error {
+			v.DeleteInputText()
+			return nil
+		}},
+		{"scroll-up", []termbox.Key{termbox.KeyPgup}, "Scroll text up", func(v *MainView) error {
+			v.ScrollText(-(v.height - TextAreaPos) / 2)
+			return nil
+		}},
+		{"scroll-down", []termbox.Key{termbox.KeyPgdn}, "Scroll text down", func(v *MainView) error {
+			v.ScrollText((v.height - TextAreaPos) / 2)
+			return nil
+		}},
+		{"split", []termbox.Key{termbox.KeyF2}, "Toggle split view (horizontal, vertical, off)", func(v *MainView) error {
+			v.ToggleSplit()
+			return nil
+		}},
+		{"split-stage", []termbox.Key{termbox.KeyF3}, "Switch stage shown next to current result in split view", func(v *MainView) error {
+			v.NextSplitRef()
+			return nil
+		}},
+		{"structured-view", []termbox.Key{termbox.KeyF4}, "Toggle JSON tree view for JSON/JSON Lines, or table view for CSV/TSV", (*MainView).ToggleStructuredView},
+		{"view-previous", []termbox.Key{termbox.KeyF5}, "Move column cursor in table view, or line cursor in JSON tree view, backward", func(v *MainView) error {
+			v.moveViewCursor(-1)
+			return nil
+		}},
+		{"view-next", []termbox.Key{termbox.KeyF6}, "Move column cursor in table view, or line cursor in JSON tree view, forward", func(v *MainView) error {
+			v.moveViewCursor(1)
+			return nil
+		}},
+		{"view-primary", []termbox.Key{termbox.KeyF7}, "Cut column in table view, fold in JSON tree view, or search next in hex view", func(v *MainView) error {
+			return v.viewAction(termbox.KeyF7)
+		}},
+		{"view-secondary", []termbox.Key{termbox.KeyF8}, "Sort by column in table view, select value in JSON tree view, or search previous in hex view", func(v *MainView) error {
+			return v.viewAction(termbox.KeyF8)
+		}},
+		{"view-tertiary", []termbox.Key{termbox.KeyF9}, "Print column with awk in table view", func(v *MainView) error {
+			return v.viewAction(termbox.KeyF9)
+		}},
+		{"regex-bench", []termbox.Key{termbox.KeyF10}, "Toggle regex workbench", func(v *MainView) error {
+			v.ToggleRegexBench()
+			return nil
+		}},
+		{"suggestions", []termbox.Key{termbox.KeyF11}, "Toggle suggestions of next command based on the shape of text", func(v *MainView) error {
+			return v.ToggleSuggestions(v.enableCommands)
+		}},
+		{"hex-view", []termbox.Key{termbox.KeyF12}, "Toggle hex view of raw bytes", func(v *MainView) error {
+			v.ToggleHexView()
+			return nil
+		}},
+		{"next-buffer", []termbox.Key{termbox.KeyCtrlN}, "Switch to next buffer", func(v *MainView) error {
+			v.NextBuffer()
+			return nil
+		}},
+		{"previous-buffer", []termbox.Key{termbox.KeyCtrlP}, "Switch to previous buffer", func(v *MainView) error {
+			v.PrevBuffer()
+			return nil
+		}},
+		{"apply-to-full", []termbox.Key{termbox.KeyCtrlR}, "Re-run stages on full input instead of sample", (*MainView).ApplyToFull},
+		{"wrap", []termbox.Key{termbox.KeyCtrlW}, "Toggle wrapping long lines", func(v *MainView) error {
+			v.ToggleWrap()
+			return nil
+		}},
+		{"copy-one-liner", []termbox.Key{termbox.KeyCtrlO}, "Copy one-liner to clipboard", message((*MainView).CopyOneLiner)},
+		{"copy-text", []termbox.Key{termbox.KeyCtrlT}, `Copy text to clipboard, or only lines of range typed such as "10,20"`, inputMessage((*MainView).CopyText)},
+		{"bookmark", []termbox.Key{termbox.KeyCtrlK}, "Bookmark current stage with name typed", inputMessage((*MainView).AddBookmark)},
+		{"bookmarks", []termbox.Key{termbox.KeyCtrlL}, "Open bookmarks to jump to or diff with, or close diff", func(v *MainView) error {
+			if v.diffView != nil {
+				v.diffView = nil
+				return nil
+			}
+			return v.ToggleBookmarks()
+		}},
+		{"environment", []termbox.Key{termbox.KeyCtrlG}, `Set environment of commands by env arguments typed, such as "LC_ALL=C"`, inputMessage((*MainView).SetEnvironment)},
+		{"macro-record", []termbox.Key{termbox.KeyCtrlV}, "Start recording keys into macro named by input, or stop and save it", message((*MainView).ToggleRecording)},
+		{"macro-play", []termbox.Key{termbox.KeyCtrlJ}, `Play macro typed with count, such as "name 3", or the last macro`, inputMessage((*MainView).PlayMacro)},
+		{"save-session", []termbox.Key{termbox.KeyCtrlS}, "Save session of every buffer", func(v *MainView) error {
+			if err := NewSession(v).Save(v.sessionPath); err != nil {
+				return fmt.Errorf("save session failed: %s", err.Error())
+			}
+			v.InputError(fmt.Sprint("session saved to ", v.sessionPath))
+			return nil
+		}},
+	}
+}
+
+// runInput invokes command typed in input area, or accepts text in filter mode when input is empty
+func (v *MainView) runInput() error {
+	if len(v.inputArea.text) < 1 {
+		if v.filter {
+			v.accepted = true
+			return errQuit
+		}
+		return nil
+	}
+
+	if v.interrupt != nil {
+		v.StartCommand(string(v.inputArea.text))
+		return nil
+	}
+	v.commandDone(v.Pipeline().Run(string(v.inputArea.text)))
+	return nil
+}
+
+// moveViewCursor moves line cursor of JSON tree view or column cursor of table view by n
+func (v *MainView) moveViewCursor(n int) {
+	if v.jsonView != nil {
+		v.jsonView.MoveCursor(n)
+		return
+	}
+	v.MoveTableColumn(n)
+}
+
+// viewAction performs action of key F7, F8 or F9 for hex view, JSON tree view or table view
+func (v *MainView) viewAction(key termbox.Key) error {
+	if v.hexView != nil {
+		if key == termbox.KeyF9 {
+			return nil
+		}
+		dir := 1
+		if key == termbox.KeyF8 {
+			dir = -1
+		}
+		m, err := v.SearchHex(dir)
+		if err != nil {
+			return err
+		}
+		v.InputError(m)
+		return nil
+	}
+	if v.jsonView != nil {
+		switch key {
+		case termbox.KeyF7:
+			v.jsonView.ToggleFold()
+		case termbox.KeyF8:
+			return v.InvokeStages([]string{v.jsonView.PathStage(v.enableCommands)})
+		}
+		return nil
+	}
+	if v.table == nil {
+		return nil
+	}
+
+	var stages []string
+	switch key {
+	case termbox.KeyF7:
+		stages = v.table.CutStages(v.tableCol)
+	case termbox.KeyF8:
+		stages = v.table.SortStages(v.tableCol)
+	case termbox.KeyF9:
+		stages = v.table.AwkStages(v.tableCol)
+	}
+	return v.InvokeStages(stages)
+}
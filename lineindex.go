@@ -0,0 +1,52 @@
+package main
+
+import "bytes"
+
+// lineIndexStride is number of lines between checkpoints of line index
+const lineIndexStride = 1024
+
+// LineIndex represent offsets of line starts in text.
+// Only every lineIndexStride-th line is recorded, so that memory use stays small for huge text.
+type LineIndex struct {
+	text []byte
+	// checkpoints are offsets of line starts of line 0, lineIndexStride, 2*lineIndexStride and so on
+	checkpoints []int
+	lines       int
+}
+
+// NewLineIndex builds line index of text
+func NewLineIndex(text []byte) *LineIndex {
+	l := &LineIndex{text: text, checkpoints: []int{0}, lines: 1}
+	for i := 0; ; {
+		n := bytes.IndexByte(text[i:], '\n')
+		if n < 0 {
+			break
+		}
+		i += n + 1
+		if l.lines%lineIndexStride == 0 {
+			l.checkpoints = append(l.checkpoints, i)
+		}
+		l.lines++
+	}
+	return l
+}
+
+// Len returns number of lines, which is number of newlines plus one
+func (l *LineIndex) Len() int {
+	return l.lines
+}
+
+// Offset returns byte offset of start of line n
+func (l *LineIndex) Offset(n int) int {
+	if n >= l.lines {
+		n = l.lines - 1
+	}
+	if n < 0 {
+		n = 0
+	}
+	i := l.checkpoints[n/lineIndexStride]
+	for k := n % lineIndexStride; k > 0; k-- {
+		i += bytes.IndexByte(l.text[i:], '\n') + 1
+	}
+	return i
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+)
+
+// Run handles events from events and redraws screen until quit.
+// Commands are streamed in background when events can be interrupted, or run to completion otherwise.
+func (v *MainView) Run(events EventSource) {
+	if i, ok := events.(Interrupter); ok {
+		v.interrupt = i.Interrupt
+	}
+
+	for {
+		v.Flush()
+
+		switch ev := v.nextEvent(events); ev.Type {
+		case termbox.EventResize:
+			v.width, v.height = ev.Width, ev.Height
+		case termbox.EventInterrupt:
+			// Help of command got in background is drawn by redraw
+			if v.running == nil {
+				continue
+			}
+			v.pollCommand()
+		case termbox.EventKey:
+			if v.running != nil {
+				v.HandleRunningKey(ev)
+				continue
+			}
+			if v.help != nil && v.HandleHelpKey(ev) {
+				continue
+			}
+			if v.palette != nil {
+				a, consumed := v.HandlePaletteKey(ev)
+				if a != nil {
+					if v.runAction(a) {
+						return
+					}
+				}
+				if consumed {
+					continue
+				}
+			}
+			if v.commandHelp != nil && v.HandleCommandHelpKey(ev) {
+				continue
+			}
+			if v.suggestions != nil && v.HandleSuggestionsKey(ev) {
+				continue
+			}
+			if v.bookmarks != nil && v.HandleBookmarksKey(ev) {
+				continue
+			}
+			if v.regexBench != nil && v.HandleRegexBenchKey(ev) {
+				continue
+			}
+
+			if a := v.lookupAction(ev.Key); a != nil {
+				if v.runAction(a) {
+					return
+				}
+				continue
+			}
+			if ev.Key == termbox.KeySpace {
+				ev.Ch = ' '
+			}
+			if ev.Ch != 0 {
+				v.InputText(ev.Ch)
+				v.ForwardCursor(ev.Ch)
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nsf/termbox-go"
+)
+
+// MacroFile is file name of macros in state directory
+const MacroFile = "macros.toml"
+
+// Macro represent key events recorded by name.
+// Keys are written in the form of "sort -k<Ctrl+E>2<Enter>", where "<" of text is written as "<lt>".
+type Macro struct {
+	Name string `toml:"name"`
+	Keys string `toml:"keys"`
+}
+
+// macroFile represents file of macros
+type macroFile struct {
+	Macros []Macro `toml:"macros"`
+}
+
+// macroRecording represents macro being recorded
+type macroRecording struct {
+	name   string
+	events []termbox.Event
+	// start is index of the first event of current key or command palette, which is dropped when recording stops by it
+	start int
+}
+
+// LoadMacros reads macros from file. No macro is returned when the file does not exist.
+func LoadMacros(path string) ([]Macro, error) {
+	var f macroFile
+	if _, err := toml.DecodeFile(path, &f); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, m := range f.Macros {
+		if _, err := decodeKeys(m.Keys); err != nil {
+			return nil, fmt.Errorf("macro %s: %s", m.Name, err.Error())
+		}
+	}
+	return f.Macros, nil
+}
+
+// SaveMacros writes macros to file, creating its directory
+func SaveMacros(path string, macros []Macro) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := toml.NewEncoder(f).Encode(macroFile{Macros: macros}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// encodeKeys returns key events written as text with names of special keys in "<" and ">"
+func encodeKeys(events []termbox.Event) string {
+	var b strings.Builder
+	for _, ev := range events {
+		switch {
+		case ev.Ch == '<':
+			b.WriteString("<lt>")
+		case ev.Ch != 0:
+			b.WriteRune(ev.Ch)
+		case ev.Key == termbox.KeySpace:
+			b.WriteByte(' ')
+		default:
+			b.WriteString("<" + keyName(ev.Key) + ">")
+		}
+	}
+	return b.String()
+}
+
+// decodeKeys returns key events of keys written by encodeKeys
+func decodeKeys(keys string) ([]termbox.Event, error) {
+	var events []termbox.Event
+	for len(keys) > 0 {
+		n := strings.IndexByte(keys, '<')
+		if n < 0 {
+			return append(events, TypeEvents(keys)...), nil
+		}
+		events = append(events, TypeEvents(keys[:n])...)
+		keys = keys[n:]
+
+		end := strings.IndexByte(keys, '>')
+		if end < 0 {
+			return nil, fmt.Errorf("%q is not closed by >", keys)
+		}
+		if name := keys[1:end]; name == "lt" {
+			events = append(events, termbox.Event{Type: termbox.EventKey, Ch: '<'})
+		} else {
+			k, err := keyByName(name)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, KeyEvent(k))
+		}
+		keys = keys[end+1:]
+	}
+	return events, nil
+}
+
+// record adds key event typed while recording. start is whether it begins a key or command palette.
+func (r *macroRecording) record(ev termbox.Event, start bool) {
+	if start {
+		r.start = len(r.events)
+	}
+	r.events = append(r.events, ev)
+}
+
+// ToggleRecording starts recording key events into macro named by input, or stops and saves it.
+// Input is cleared only when recording starts, since it is the name.
+func (v *MainView) ToggleRecording() (string, error) {
+	if v.replaying {
+		return "", errors.New("macro cannot record macro")
+	}
+	if r := v.recording; r != nil {
+		v.recording = nil
+		// Key or command palette stopping recording is not a part of macro
+		events := r.events[:r.start]
+		if len(events) < 1 {
+			return "", fmt.Errorf("macro %s is empty", r.name)
+		}
+		v.setMacro(Macro{Name: r.name, Keys: encodeKeys(events)})
+		v.lastMacro = r.name
+		if err := SaveMacros(v.macroPath, v.macros); err != nil {
+			return "", fmt.Errorf("save macros failed: %s", err.Error())
+		}
+		return fmt.Sprintf("macro %s recorded: %d keys", r.name, len(events)), nil
+	}
+
+	name := strings.TrimSpace(string(v.inputArea.text))
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return "", errors.New("type name of macro to record")
+	}
+	v.ClearInputText()
+	v.recording = &macroRecording{name: name}
+	return fmt.Sprintf("recording macro %s", name), nil
+}
+
+// PlayMacro replays macro typed in input such as "name 3", the number of times.
+// Name can be omitted to replay macro recorded or played last.
+func (v *MainView) PlayMacro(input string) (string, error) {
+	fields := strings.Fields(input)
+	name, count := v.lastMacro, 1
+	if len(fields) > 0 {
+		if n, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+			count = n
+			fields = fields[:len(fields)-1]
+		}
+	}
+	switch len(fields) {
+	case 0:
+	case 1:
+		name = fields[0]
+	default:
+		return "", errors.New(`type name of macro and count, such as "name 3"`)
+	}
+	if name == "" {
+		return "", errors.New("type name of macro to play")
+	}
+	if count < 1 {
+		return "", fmt.Errorf("count of macro must be positive: %d", count)
+	}
+	if err := v.queueMacro(name, count); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("playing macro %s %d times", name, count), nil
+}
+
+// queueMacro queues events of macro the number of times, to be handled by main loop before events of terminal
+func (v *MainView) queueMacro(name string, count int) error {
+	if v.replaying {
+		return errors.New("macro cannot play macro")
+	}
+	if v.recording != nil {
+		return errors.New("macro cannot be played while recording")
+	}
+	m := v.macro(name)
+	if m == nil {
+		return fmt.Errorf("macro %s is not found", name)
+	}
+	events, err := decodeKeys(m.Keys)
+	if err != nil {
+		return err
+	}
+
+	v.lastMacro = name
+	for n := 0; n < count; n++ {
+		v.pending = append(v.pending, events...)
+	}
+	return nil
+}
+
+// macro returns macro of name, or nil
+func (v *MainView) macro(name string) *Macro {
+	for n := range v.macros {
+		if v.macros[n].Name == name {
+			return &v.macros[n]
+		}
+	}
+	return nil
+}
+
+// setMacro adds or replaces macro, and binds action playing it to key of configuration
+func (v *MainView) setMacro(m Macro) {
+	if p := v.macro(m.Name); p != nil {
+		*p = m
+	} else {
+		v.macros = append(v.macros, m)
+	}
+
+	a := Action{
+		Name:        "macro " + m.Name,
+		Description: fmt.Sprint("Play macro: ", m.Keys),
+		Run: func(v *MainView) error {
+			return v.queueMacro(m.Name, 1)
+		},
+	}
+	if k, ok := v.macroKeys[m.Name]; ok {
+		a.Keys = []termbox.Key{k}
+	}
+	for n := range v.keymap {
+		if v.keymap[n].Name == a.Name {
+			v.keymap[n] = a
+			return
+		}
+	}
+	v.keymap = append(v.keymap, a)
+}
+
+// nextEvent returns event of macro being played, or event of terminal.
+// Events of macro wait while command is running, so that macro is replayed in the same way as typed.
+func (v *MainView) nextEvent(events EventSource) termbox.Event {
+	if len(v.pending) > 0 && v.running == nil {
+		ev := v.pending[0]
+		v.pending = v.pending[1:]
+		v.replaying = true
+		return ev
+	}
+
+	v.replaying = false
+	ev := events.PollEvent()
+	// Keys for running command depend on timing, so that they are not recorded
+	if r := v.recording; r != nil && ev.Type == termbox.EventKey && v.running == nil {
+		r.record(ev, v.palette == nil)
+	}
+	return ev
+}
+
+// stopMacro discards events of macro being played, after error
+func (v *MainView) stopMacro() {
+	v.pending = nil
+}
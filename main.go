@@ -1,21 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"strings"
-	"syscall"
+	"text/template"
 	"unicode/utf8"
 
 	"github.com/mattn/go-runewidth"
-	"github.com/mattn/go-shellwords"
 	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
 )
 
 const (
@@ -29,13 +27,18 @@ const (
 const (
 	ExitCodeOK    = 0
 	ExitCodeError = 10 + iota
+	// ExitCodeAborted is exit code of filter mode quit without accepting text
+	ExitCodeAborted
 )
 
+// LargeFileSize is file size from which source is mapped into memory instead of being read
+const LargeFileSize = 64 << 20
+
 // Positions are y-coordinate for areas and line
 const (
 	InputAreaPos = iota
 	InputErrorPos
-	BorderLinePos
+	StatusBarPos
 	TextAreaPos
 )
 
@@ -50,45 +53,301 @@ const (
 type MainView struct {
 	textArea  TextArea
 	inputArea InputArea
-	height    int
-	width     int
+	buffers   []Buffer
+	current   int
+	split     int
+	splitRef  int
+	table     *Table
+	tableCol  int
+	jsonView  *JSONView
+	hexView   *HexView
+	diffView  *DiffView
+	// wrap is whether long lines are wrapped in text area
+	wrap bool
+	// binary is whether current text has been detected as binary
+	binary      bool
+	regexBench  *RegexBench
+	suggestions *SuggestionPicker
+	bookmarks   *BookmarkPicker
+	help        *HelpView
+	palette     *CommandPalette
+	commandHelp *CommandHelp
+	// commandHelps are help of commands got for the session, by command name
+	commandHelps map[string]*usageFetch
+
+	macros    []Macro
+	macroKeys map[string]termbox.Key
+	macroPath string
+	lastMacro string
+	recording *macroRecording
+	// pending are events of macro being played, and replaying is whether current event is one of them
+	pending   []termbox.Event
+	replaying bool
+	// keymap is actions bound to keys
+	keymap []Action
+	screen Screen
+	height int
+	width  int
+
+	metrics        textMetrics
+	statusTemplate *template.Template
+	// running is command running in background, whose output is shown in text area
+	running *runningCommand
+	// interrupt wakes main loop up to redraw output of running command
+	interrupt func()
+	// filter is whether text is printed on accept instead of one-liner, and accepted is whether it has been accepted
+	filter   bool
+	accepted bool
+
+	enableCommands []string
+	configPath     string
+	sessionPath    string
+}
+
+// NewMainView returns main view drawn on screen, showing first buffer
+func NewMainView(screen Screen, buffers []Buffer, conf *Config, sessionPath string) *MainView {
+	w, h := screen.Size()
+	prompt := []byte(Name + "> ")
+	v := &MainView{
+		inputArea: InputArea{
+			cursorInitialPos: len(prompt),
+			prompt:           prompt,
+		},
+		buffers:        buffers,
+		screen:         screen,
+		width:          w,
+		height:         h,
+		keymap:         defaultKeymap(),
+		commandHelps:   make(map[string]*usageFetch),
+		macroKeys:      conf.macroKeys,
+		macroPath:      conf.MacroPath(),
+		configPath:     conf.path,
+		statusTemplate: conf.statusTemplate,
+		enableCommands: conf.EnableCommands,
+		sessionPath:    sessionPath,
+	}
+	v.loadBuffer(0)
+	v.InitCursor()
+	return v
+}
+
+// Close closes overlays and saves state of current buffer, after interactive mode is quit
+func (v *MainView) Close() {
+	if v.regexBench != nil {
+		v.ToggleRegexBench()
+	}
+	v.storeBuffer()
+}
+
+// OneLiners returns one-liner of each buffer
+func (v *MainView) OneLiners() []string {
+	var lines []string
+	for _, b := range v.buffers {
+		lines = append(lines, b.pipeline.Shell())
+	}
+	return lines
 }
 
-// Flush invokes termbox.Flush() after updates back buffers and set cursor
+// Flush invokes Flush() of screen after updates back buffers and set cursor
 func (v *MainView) Flush() error {
-	if err := termbox.Clear(ColBg, ColBg); err != nil {
+	if err := v.screen.Clear(ColBg, ColBg); err != nil {
 		return err
 	}
 
-	termbox.SetCursor(v.inputArea.cursorPos, InputAreaPos)
-	v.DrawBorderLine()
+	v.screen.SetCursor(v.inputArea.cursorPos, InputAreaPos)
+	v.DrawStatusBar()
 	v.DrawInputArea()
 	v.DrawInputError()
 	v.DrawTextArea()
-
-	return termbox.Flush()
-}
-
-// DrawBorderLine draws line between input area and text area
-func (v *MainView) DrawBorderLine() {
-	for x := 0; x < v.width; x++ {
-		termbox.SetCell(x, BorderLinePos, rune('-'), ColFg, ColBg)
+	if v.commandHelp != nil && v.help == nil && v.palette == nil && v.running == nil {
+		v.drawCommandHelp()
 	}
+
+	return v.screen.Flush()
 }
 
 // DrawInputArea updates back buffer for input area
 func (v *MainView) DrawInputArea() {
-	v.inputArea.drawText(v.width, v.height)
+	v.inputArea.drawText(v.screen, v.width, v.height)
 }
 
 // DrawInputError updates back buffer for input error area
 func (v *MainView) DrawInputError() {
-	v.inputArea.drawError()
+	v.inputArea.drawError(v.screen)
 }
 
 // DrawTextArea updates back buffer for text area
 func (v *MainView) DrawTextArea() {
-	v.textArea.drawText()
+	if v.help != nil {
+		v.drawHelp()
+		return
+	}
+	if v.palette != nil {
+		v.drawPalette()
+		return
+	}
+	if v.running != nil {
+		v.textArea.drawText(v.screen, v.width, v.height, v.wrap)
+		return
+	}
+	if v.suggestions != nil {
+		v.drawSuggestions()
+		return
+	}
+	if v.bookmarks != nil {
+		v.drawBookmarks()
+		return
+	}
+	if v.diffView != nil {
+		v.diffView.draw(v.screen, 0, TextAreaPos, v.width, v.height-TextAreaPos, v.textArea.offset)
+		return
+	}
+	if v.regexBench != nil {
+		v.drawRegexBench()
+		return
+	}
+	if v.split != SplitNone {
+		v.drawSplit()
+		return
+	}
+	if v.hexView != nil {
+		v.hexView.draw(v.screen, 0, TextAreaPos, v.width, v.height-TextAreaPos, v.textArea.offset)
+		return
+	}
+	if v.jsonView != nil {
+		v.jsonView.draw(v.screen, 0, TextAreaPos, v.width, v.height-TextAreaPos, &v.textArea.offset)
+		return
+	}
+	if v.table != nil {
+		v.table.draw(v.screen, 0, TextAreaPos, v.width, v.height-TextAreaPos, v.textArea.offset, v.tableCol)
+		return
+	}
+	v.textArea.drawText(v.screen, v.width, v.height, v.wrap)
+}
+
+// Pipeline returns pipeline of current buffer
+func (v *MainView) Pipeline() *pipeline.Pipeline {
+	return v.buffers[v.current].pipeline
+}
+
+// InvokeStages invokes stages in order and adds them to pipeline of current buffer.
+// When a stage fails, text is reverted to the one before the first stage.
+func (v *MainView) InvokeStages(stages []string) error {
+	err := v.Pipeline().RunAll(stages)
+	v.syncText()
+	return err
+}
+
+// Undo reverts last stage of current buffer
+func (v *MainView) Undo() {
+	if v.Pipeline().Undo() {
+		v.syncText()
+	}
+}
+
+// Redo restores stage reverted by Undo
+func (v *MainView) Redo() {
+	if v.Pipeline().Redo() {
+		v.syncText()
+	}
+}
+
+// syncText sets output of pipeline on text area, converted into UTF-8 if needed
+func (v *MainView) syncText() {
+	v.textArea.setText(v.displayText(v.Pipeline().Text()))
+	v.metrics = countText(v.Pipeline().Text())
+	v.textArea.scroll(0)
+	v.diffView = nil
+	v.buffers[v.current].pruneBookmarks()
+	v.clampBookmarks()
+	v.refreshView()
+	v.refreshHexView()
+}
+
+// displayText returns text of current buffer converted into UTF-8 if needed.
+// Text is shown as is when it cannot be converted. Conversion of the last text is reused.
+func (v *MainView) displayText(text []byte) []byte {
+	b := &v.buffers[v.current]
+	if b.encoding == "" {
+		return text
+	}
+	if d := b.display; d != nil && sameBytes(d.text, text) {
+		return d.converted
+	}
+
+	converted, err := pipeline.ConvertToUTF8(text, b.encoding, true)
+	if err != nil {
+		converted = text
+	}
+	b.display = &displayCache{text: text, converted: converted}
+	return converted
+}
+
+// sameBytes reports whether a and b are the same slice, not only equal bytes
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// ScrollText scrolls text area by n lines
+func (v *MainView) ScrollText(n int) {
+	if v.jsonView != nil {
+		v.jsonView.MoveCursor(n)
+		return
+	}
+	if v.hexView != nil || v.diffView != nil {
+		var max int
+		if v.diffView != nil {
+			max = len(v.diffView.lines) - 1
+		} else {
+			max = v.hexView.Rows(v.width) - 1
+		}
+		v.textArea.offset += n
+		if v.textArea.offset > max {
+			v.textArea.offset = max
+		}
+		if v.textArea.offset < 0 {
+			v.textArea.offset = 0
+		}
+		return
+	}
+	v.textArea.scroll(n)
+}
+
+// ToggleStructuredView switches text area between raw text and JSON tree or table, detected by text
+func (v *MainView) ToggleStructuredView() error {
+	if v.table != nil || v.jsonView != nil {
+		v.table = nil
+		v.jsonView = nil
+		return nil
+	}
+
+	if c := pipeline.FirstByte(v.textArea.text); c == '{' || c == '[' {
+		j, err := ParseJSONView(v.textArea.text)
+		if err != nil {
+			return err
+		}
+		v.jsonView = j
+		return nil
+	}
+
+	t, err := ParseTable(v.textArea.text)
+	if err != nil {
+		return err
+	}
+	v.table = t
+	v.tableCol = 0
+	return nil
+}
+
+// refreshView parses text area again for structured view after text changed.
+// Structured view is turned off when text cannot be parsed any more.
+func (v *MainView) refreshView() {
+	if v.table == nil && v.jsonView == nil {
+		return
+	}
+	v.table = nil
+	v.jsonView = nil
+	v.ToggleStructuredView()
 }
 
 // InputText adds byte by input
@@ -131,16 +390,6 @@ func (v *MainView) BackwardCursor() {
 	v.inputArea.backwardCursor()
 }
 
-// SaveInvokeCommand saves invoked commands as list
-func (v *MainView) SaveInvokeCommand() {
-	v.inputArea.saveInvokeCommand()
-}
-
-// RedoInvokeCommands reverts invoked command list to preview version
-func (v *MainView) RedoInvokeCommands() {
-	v.inputArea.redoInvokeCommands()
-}
-
 // SaveInputHistory saves invoked commands as history list
 func (v *MainView) SaveInputHistory() {
 	v.inputArea.saveHistory()
@@ -166,21 +415,6 @@ func (v *MainView) ClearInputText() {
 	v.inputArea.clear()
 }
 
-// SetText sets content on text area
-func (v *MainView) SetText(out *[]byte) {
-	v.textArea.setText(out)
-}
-
-// RedoText reverts content of text area to preview version
-func (v *MainView) RedoText() {
-	v.textArea.redo()
-}
-
-// SaveTextHistory saves manipulated text history as list
-func (v *MainView) SaveTextHistory() {
-	v.textArea.saveHistory()
-}
-
 // InputArea represent input area
 type InputArea struct {
 	text             []byte
@@ -191,7 +425,6 @@ type InputArea struct {
 	prompt           []byte
 	history          []string
 	historyPos       int
-	invokeCommands   []string
 }
 
 func (i *InputArea) cursorOffset() int {
@@ -258,10 +491,6 @@ func (i *InputArea) backwardCursor() {
 	i.cursorByteOffset -= size
 }
 
-func (i *InputArea) saveInvokeCommand() {
-	i.invokeCommands = append(i.invokeCommands, string(i.text))
-}
-
 func (i *InputArea) saveHistory() {
 	i.history = append(i.history, string(i.text))
 	i.historyPos = len(i.history)
@@ -283,9 +512,9 @@ func (i *InputArea) backwardHistoryIndex() {
 	i.historyPos--
 }
 
-func (i *InputArea) drawText(width, hight int) {
+func (i *InputArea) drawText(s Screen, width, hight int) {
 	for x, t := range i.prompt {
-		termbox.SetCell(x, InputAreaPos, rune(t), ColFg, ColBg)
+		s.SetCell(x, InputAreaPos, rune(t), ColFg, ColBg)
 	}
 
 	if len(i.text) < 1 {
@@ -294,12 +523,12 @@ func (i *InputArea) drawText(width, hight int) {
 
 	var x int
 	for _, c := range string(i.text) {
-		termbox.SetCell(i.cursorInitialPos+x, InputAreaPos, c, ColFg, ColBg)
+		s.SetCell(i.cursorInitialPos+x, InputAreaPos, c, ColFg, ColBg)
 		x += runewidth.RuneWidth(c)
 	}
 
 	for x := x; x < width; x++ {
-		termbox.SetCell(i.cursorInitialPos+x, InputAreaPos, rune(' '), ColFg, ColBg)
+		s.SetCell(i.cursorInitialPos+x, InputAreaPos, rune(' '), ColFg, ColBg)
 	}
 }
 
@@ -317,23 +546,19 @@ func (i *InputArea) clear() {
 	i.text = []byte("")
 }
 
-func (i *InputArea) drawError() {
+func (i *InputArea) drawError(s Screen) {
 	if len(i.error) < 1 {
 		return
 	}
 
 	var x int
 	for _, t := range string(i.error) {
-		termbox.SetCell(x, InputErrorPos, t, ColErr, ColBg)
+		s.SetCell(x, InputErrorPos, t, ColErr, ColBg)
 		x += runewidth.RuneWidth(t)
 	}
 	i.error = []byte("")
 }
 
-func (i *InputArea) redoInvokeCommands() {
-	i.invokeCommands = i.invokeCommands[:len(i.invokeCommands)-1]
-}
-
 func (i *InputArea) delete() {
 	if len(i.text) < 1 {
 		return
@@ -345,45 +570,86 @@ func (i *InputArea) delete() {
 
 // TextArea represent text area
 type TextArea struct {
-	text    []byte
-	history []string
+	text   []byte
+	index  *LineIndex
+	offset int
+}
+
+func (t *TextArea) setText(text []byte) {
+	t.text = text
+	t.index = NewLineIndex(text)
+}
+
+// drawText updates back buffer for visible lines only
+func (t *TextArea) drawText(s Screen, width, height int, wrap bool) {
+	drawTextBox(s, t.text[t.index.Offset(t.offset):], 0, TextAreaPos, width, height-TextAreaPos, 0, wrap)
 }
 
-func (t *TextArea) setText(out *[]byte) {
-	t.text = *out
+func (t *TextArea) scroll(n int) {
+	t.offset += n
+	if max := t.index.Len() - 1; t.offset > max {
+		t.offset = max
+	}
+	if t.offset < 0 {
+		t.offset = 0
+	}
 }
 
-func (t *TextArea) drawText() {
-	y := TextAreaPos
+// drawTextBox updates back buffer for text in the box, starting at line offset.
+// Long lines are wrapped when wrap is true, or cut off otherwise.
+func drawTextBox(s Screen, text []byte, x0, y0, width, height, offset int, wrap bool) {
+	for ; offset > 0; offset-- {
+		n := bytes.IndexByte(text, '\n')
+		if n < 0 {
+			return
+		}
+		text = text[n+1:]
+	}
+
+	y := y0
 	x := 0
-	for _, t := range string(t.text) {
-		if t == '\n' {
+	for len(text) > 0 {
+		c, size := utf8.DecodeRune(text)
+		text = text[size:]
+		if y >= y0+height {
+			return
+		}
+		if c == '\n' {
 			y++
 			x = 0
 			continue
 		}
-		termbox.SetCell(x, y, t, ColFg, ColBg)
-		x += runewidth.RuneWidth(t)
+		if x+runewidth.RuneWidth(c) > width {
+			if !wrap {
+				continue
+			}
+			y++
+			x = 0
+			if y >= y0+height {
+				return
+			}
+		}
+		s.SetCell(x0+x, y, c, ColFg, ColBg)
+		x += runewidth.RuneWidth(c)
 	}
 }
 
-func (t *TextArea) redo() {
-	t.text = []byte(t.history[len(t.history)-1])
-	t.history = t.history[:len(t.history)-1]
-}
-
-func (t *TextArea) saveHistory() {
-	t.history = append(t.history, string(t.text))
-}
-
 func main() {
 	os.Exit(_main())
 }
 
 func _main() int {
 	var (
-		config  string
-		version bool
+		config   string
+		version  bool
+		save     string
+		replay   string
+		resume   string
+		encoding string
+		large    bool
+		sample   string
+		filter   bool
+		stages   stringsFlag
 	)
 
 	flags := flag.NewFlagSet(Name, flag.ContinueOnError)
@@ -391,6 +657,14 @@ func _main() int {
 	flags.StringVar(&config, "c", "txtmanip.toml", "")
 	flags.StringVar(&config, "config", "txtmanip.toml", "")
 	flags.BoolVar(&version, "version", false, "")
+	flags.StringVar(&save, "save", "", "")
+	flags.StringVar(&replay, "replay", "", "")
+	flags.Var(&stages, "e", "")
+	flags.StringVar(&resume, "resume", "", "")
+	flags.StringVar(&encoding, "encoding", "", "")
+	flags.BoolVar(&large, "large", false, "")
+	flags.StringVar(&sample, "sample", "", "")
+	flags.BoolVar(&filter, "filter", false, "")
 	if err := flags.Parse(os.Args[1:]); err != nil {
 		return ExitCodeError
 	}
@@ -399,213 +673,392 @@ func _main() int {
 		fmt.Printf("%s version %s\n", Name, Version)
 		return ExitCodeOK
 	}
-	var src *os.File
-	var f string
+	files := flags.Args()
 
-	if len(flags.Args()) < 1 {
-		src = os.Stdin
-	} else {
-		f = flags.Arg(0)
-		if _, err := os.Stat(f); os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "%s is not exist: %s\n", f, err.Error())
+	conf, err := LoadConfig(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Read config failed: %s\n", err.Error())
+		return ExitCodeError
+	}
+
+	var sampling *pipeline.Sampling
+	if sample != "" {
+		s, err := pipeline.ParseSampling(sample)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
 			return ExitCodeError
 		}
-		file, err := os.Open(f)
+		sampling = &s
+	}
+
+	if replay != "" || len(stages) > 0 {
+		if save != "" {
+			fmt.Fprintln(os.Stderr, "-save cannot be used with -replay or -e, since session is saved on quit of interactive mode")
+			return ExitCodeError
+		}
+
+		// Each target is file with recorded pipeline of session buffer applied to it
+		type target struct {
+			file   string
+			buffer *SessionBuffer
+		}
+		var targets []target
+		if replay != "" {
+			session, err := LoadSession(replay)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Read session failed: %s\n", err.Error())
+				return ExitCodeError
+			}
+			if len(files) < 1 {
+				// Every buffer is replayed on its own source
+				for n := range session.Buffers {
+					targets = append(targets, target{file: session.Buffers[n].Source, buffer: &session.Buffers[n]})
+				}
+			} else if b := session.Buffer(session.Current); b != nil {
+				for _, f := range files {
+					targets = append(targets, target{file: f, buffer: b})
+				}
+			}
+		}
+		if targets == nil {
+			if len(files) < 1 {
+				files = []string{""}
+			}
+			for _, f := range files {
+				targets = append(targets, target{file: f})
+			}
+		}
+
+		for _, t := range targets {
+			f, sb := t.file, t.buffer
+			var source pipeline.Source
+			if sb != nil && f == "" && sb.SourceText != "" && !pipedStdin() {
+				// Text stored in session is used only when nothing is piped
+				source = pipeline.Source{Text: []byte(sb.SourceText), Encoding: sb.SourceEncoding}
+			} else {
+				var warn string
+				if source, _, warn, err = openSource(conf, f, large, encoding); err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+					return ExitCodeError
+				}
+				if warn != "" {
+					fmt.Fprintln(os.Stderr, fmt.Sprint("warning: ", warn))
+				}
+			}
+
+			// Pipeline of sample does not own source, so that source is closed along with the pipeline
+			var p *pipeline.Pipeline
+			if sampling != nil {
+				p = conf.NewPipeline(sampleSource(source, *sampling))
+			} else {
+				p = conf.NewPipeline(source)
+			}
+			closePipeline := func() {
+				p.Close()
+				if sampling != nil {
+					source.Close()
+				}
+			}
+			commands := stages
+			var hash string
+			if sb != nil {
+				if err := sb.apply(p); err != nil {
+					closePipeline()
+					fmt.Fprintln(os.Stderr, err.Error())
+					return ExitCodeError
+				}
+				commands = append(append([]string{}, sb.Stages...), stages...)
+				// The recorded hash only holds for the recorded stages on the recorded source, which is not sampled
+				if len(stages) < 1 && sampling == nil && sb.IsSource(source) {
+					hash = sb.OutputSHA256
+				}
+			}
+			err := Replay(os.Stdout, p, commands, hash)
+			closePipeline()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				return ExitCodeError
+			}
+		}
+		return ExitCodeOK
+	}
+
+	var session *Session
+	if resume != "" {
+		session, err = LoadSession(resume)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Open file failed: %s\n", err.Error())
+			fmt.Fprintf(os.Stderr, "Read session failed: %s\n", err.Error())
 			return ExitCodeError
 		}
-		src = file
+		if len(files) < 1 {
+			// Every buffer is reopened, where source of standard input is empty
+			for _, b := range session.Buffers {
+				files = append(files, b.Source)
+			}
+		}
+	}
+	if len(files) < 1 {
+		files = []string{""}
 	}
 
-	fi, err := src.Stat()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Get file stat failed: %s\n", err.Error())
-		return ExitCodeError
+	buffers := make([]Buffer, 0, len(files))
+	defer func() {
+		for _, b := range buffers {
+			b.pipeline.Close()
+			if b.full != nil {
+				b.full.Close()
+			}
+		}
+	}()
+	var warnings []string
+	for n, f := range files {
+		var (
+			source          pipeline.Source
+			displayEncoding string
+			warn            string
+			sb              *SessionBuffer
+		)
+		if session != nil {
+			sb = session.Buffer(n)
+		}
+		if sb != nil && f == "" && sb.SourceText != "" && !pipedStdin() {
+			// Text has been converted already when it was saved
+			source = pipeline.Source{Text: []byte(sb.SourceText), Encoding: sb.SourceEncoding}
+			if sb.SourceEncoding == "" {
+				source, displayEncoding, warn = conf.LoadSource(f, source.Text, encoding)
+			}
+		} else {
+			source, displayEncoding, warn, err = openSource(conf, f, large, encoding)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return ExitCodeError
+		}
+		if warn != "" {
+			warnings = append(warnings, warn)
+		}
+		b := Buffer{pipeline: conf.NewPipeline(source), encoding: displayEncoding}
+		if sampling != nil {
+			b.full, b.sampling = &source, sampling.String()
+			b.pipeline = conf.NewPipeline(sampleSource(source, *sampling))
+		}
+		buffers = append(buffers, b)
 	}
 
-	if fi.Size() < 1 {
-		fmt.Fprintf(os.Stderr, "Missing input\n")
-		return ExitCodeError
+	sessionPath := save
+	if sessionPath == "" {
+		sessionPath = resume
+	}
+	if sessionPath == "" {
+		sessionPath = DefaultSessionPath
 	}
 
-	text, err := ioutil.ReadAll(src)
+	macros, err := LoadMacros(conf.MacroPath())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Reading from src failed: %s\n", err.Error())
+		fmt.Fprintf(os.Stderr, "Read macros failed: %s\n", err.Error())
 		return ExitCodeError
 	}
 
-	enableCommands, err := GetEnableCommands(config)
+	screen, err := NewTermboxScreen()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Read config failed: %s\n", err.Error())
+		fmt.Fprintln(os.Stderr, fmt.Sprint("initialize failed: ", err.Error()))
 		return ExitCodeError
 	}
 
-	invokeCommandsCh := make(chan []string)
-	errCh := make(chan error)
+	view := NewMainView(screen, buffers, conf, sessionPath)
+	view.filter = filter
+	for _, m := range macros {
+		view.setMacro(m)
+	}
+	if session != nil {
+		warnings = append(warnings, session.Restore(view)...)
+	}
+	if len(warnings) > 0 {
+		view.InputError(fmt.Sprint("warning: ", strings.Join(warnings, ", ")))
+	}
 
-	go func() {
-		if err := termbox.Init(); err != nil {
-			errCh <- errors.New(fmt.Sprint("initialize failed: ", err.Error()))
-			return
-		}
+	view.Run(screen)
+	screen.Close()
+	view.Close()
+	if filter && !view.accepted {
+		return ExitCodeAborted
+	}
 
-		w, h := termbox.Size()
-		prompt := []byte(Name + "> ")
-		view := &MainView{
-			textArea: TextArea{
-				text: text,
-			},
-			inputArea: InputArea{
-				cursorInitialPos: len(prompt),
-				prompt:           prompt,
-			},
-			width:  w,
-			height: h,
+	if save != "" {
+		if err := NewSession(view).Save(save); err != nil {
+			fmt.Fprintf(os.Stderr, "Save session failed: %s\n", err.Error())
+			return ExitCodeError
 		}
-		defer func() {
-			termbox.Close()
-			invokeCommandsCh <- view.inputArea.invokeCommands
-		}()
-
-		termbox.SetInputMode(termbox.InputEsc)
-		view.InitCursor()
-
-	mainloop:
-		for {
-			view.Flush()
-
-			switch ev := termbox.PollEvent(); ev.Type {
-			case termbox.EventKey:
-				switch ev.Key {
-				case termbox.KeyEsc, termbox.KeyCtrlC:
-					break mainloop
-				case termbox.KeyCtrlA:
-					view.InitCursor()
-				case termbox.KeyCtrlE:
-					view.EndCursor()
-				case termbox.KeyArrowLeft, termbox.KeyCtrlB:
-					view.BackwardCursor()
-				case termbox.KeyArrowRight, termbox.KeyCtrlF:
-					view.ForwardOneRuneCursor()
-				case termbox.KeyArrowUp:
-					view.BackwardInputHistory()
-					view.DrawInputHistory()
-				case termbox.KeyArrowDown:
-					view.ForwardInputHistory()
-					view.DrawInputHistory()
-				case termbox.KeySpace:
-					view.InputText(rune(' '))
-					view.ForwardCursor(rune(' '))
-				case termbox.KeyCtrlZ:
-					if len(view.textArea.history) < 1 {
-						continue
-					}
-					view.RedoText()
-					view.RedoInvokeCommands()
-				case termbox.KeyBackspace, termbox.KeyBackspace2:
-					view.BackwardCursor()
-					view.DeleteInputText()
-				case termbox.KeyDelete, termbox.KeyCtrlD:
-					view.DeleteInputText()
-				case termbox.KeyEnter:
-					if len(view.inputArea.text) < 1 {
-						continue
-					}
-
-					args, err := shellwords.Parse(string(view.inputArea.text))
-					if err != nil {
-						errCh <- errors.New(fmt.Sprint("parse command failed: ", err.Error()))
-						return
-					}
-
-					baseCommand, opts := args[0], args[1:]
-
-					var enabled bool
-					for _, c := range enableCommands {
-						if baseCommand == c {
-							enabled = true
-						}
-					}
-					if !enabled {
-						view.ClearInputText()
-						view.InputError(fmt.Sprint(baseCommand, " cannot be executed"))
-						continue
-					}
-
-					cmd := exec.Command(baseCommand, opts...)
-					cmd.Stdin = bufio.NewReader(bytes.NewBuffer(view.textArea.text))
-
-					out, err := cmd.Output()
-					if err != nil {
-						var isNotError bool
-						if exitErr, ok := err.(*exec.ExitError); ok {
-							// Workaround:
-							// "grep" exits with return status 1 when no lines matched.
-							// In this case is not error and I want to avoid deal with error it case.
-							if baseCommand == "grep" {
-								if ws, ok := exitErr.ProcessState.Sys().(syscall.WaitStatus); ok && ws.ExitStatus() == 1 {
-									isNotError = true
-								}
-							}
-							view.InputError(string(exitErr.Stderr))
-						} else {
-							view.InputError(err.Error())
-						}
-
-						if !isNotError {
-							view.ClearInputText()
-							continue
-						}
-					}
-
-					view.SaveTextHistory()
-					view.SetText(&out)
-					view.SaveInputHistory()
-					view.SaveInvokeCommand()
-					view.ClearInputText()
-				default:
-					if ev.Ch != 0 {
-						view.InputText(ev.Ch)
-						view.ForwardCursor(ev.Ch)
-					}
-				}
-			}
+	}
+	for _, b := range view.buffers {
+		if b.full != nil && b.pipeline.Len() > 0 && !filter {
+			fmt.Fprintf(os.Stderr, "note: stages of %s have been tried on %s only\n", b.DisplayName(), b.sampling)
 		}
-	}()
+	}
+	var copied []byte
+	switch conf.CopyOnExit {
+	case "one-liner":
+		copied = []byte(strings.Join(view.OneLiners(), "\n"))
+	case "text":
+		copied = view.textArea.text
+	}
+	if copied != nil {
+		if err := CopyToClipboard(copied); err != nil {
+			fmt.Fprintf(os.Stderr, "Copy to clipboard failed: %s\n", err.Error())
+		}
+	}
+	if filter {
+		return printFiltered(view)
+	}
+	for _, l := range view.OneLiners() {
+		fmt.Println(l)
+	}
+	return ExitCodeOK
+}
+
+// printFiltered prints text of current buffer accepted in filter mode, and its one-liner to stderr.
+// Stages tried on sample are re-run on full input.
+func printFiltered(v *MainView) int {
+	b := &v.buffers[v.current]
+	if b.full != nil {
+		full, err := b.pipeline.Rerun(*b.full, nil)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return ExitCodeError
+		}
+		// Full input is owned by the pipeline from now, which is closed with buffers
+		b.pipeline.Close()
+		b.pipeline, b.full, b.sampling = full, nil, ""
+	}
 
-	select {
-	case err := <-errCh:
-		fmt.Fprintf(os.Stderr, err.Error())
+	p := b.pipeline
+	if _, err := os.Stdout.Write(p.Text()); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
 		return ExitCodeError
-	case invokeCommands := <-invokeCommandsCh:
-		var base string
-		if f == "" {
-			base = "<source>"
-		} else {
-			base = fmt.Sprintf("cat %s", f)
+	}
+	fmt.Fprintln(os.Stderr, p.Shell())
+	return ExitCodeOK
+}
+
+// openSource opens file, or standard input when f is empty, as source.
+// Large file is mapped into memory and passed to commands as is, without encoding conversion.
+// warn is set when text is not converted because conversion failed.
+func openSource(conf *Config, f string, large bool, encoding string) (source pipeline.Source, displayEncoding string, warn string, err error) {
+	if f != "" && !large {
+		if fi, err := os.Stat(f); err == nil && fi.Size() >= LargeFileSize {
+			large = true
 		}
-		fmt.Println(strings.Join(append([]string{base}, invokeCommands...), " | "))
-		return ExitCodeOK
 	}
+	if !large {
+		text, err := readSource(f)
+		if err != nil {
+			return pipeline.Source{}, "", "", err
+		}
+		source, displayEncoding, warn = conf.LoadSource(f, text, encoding)
+		return source, displayEncoding, warn, nil
+	}
+
+	if !pipeline.IsUTF8(encoding) {
+		return pipeline.Source{}, "", "", errors.New("encoding conversion is not supported for large file")
+	}
+	src := os.Stdin
+	if f != "" {
+		file, err := os.Open(f)
+		if err != nil {
+			return pipeline.Source{}, "", "", fmt.Errorf("Open file failed: %s", err.Error())
+		}
+		defer file.Close()
+		src = file
+	}
+
+	source, err = pipeline.MapSource(f, src)
+	if err != nil {
+		return pipeline.Source{}, "", "", fmt.Errorf("Mapping src failed: %s", err.Error())
+	}
+	if len(source.Text) < 1 {
+		source.Close()
+		return pipeline.Source{}, "", "", errors.New("Missing input")
+	}
+	return source, "", "", nil
+}
+
+// pipedStdin reports whether standard input is redirected from pipe or file instead of terminal
+func pipedStdin() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
+
+// readSource reads text from file, or from standard input when f is empty
+func readSource(f string) ([]byte, error) {
+	var src *os.File
+
+	if f == "" {
+		src = os.Stdin
+	} else {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s is not exist: %s", f, err.Error())
+		}
+		file, err := os.Open(f)
+		if err != nil {
+			return nil, fmt.Errorf("Open file failed: %s", err.Error())
+		}
+		defer file.Close()
+		src = file
+	}
+
+	text, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("Reading from src failed: %s", err.Error())
+	}
+
+	if len(text) < 1 {
+		return nil, errors.New("Missing input")
+	}
+
+	return text, nil
+}
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, `Usage: textmanip [options] [FILE]
+	fmt.Fprintf(os.Stderr, `Usage: textmanip [options] [FILE]...
+       textmanip -replay SESSION [-e COMMAND]... [FILE]
+       textmanip -e COMMAND [-e COMMAND]... [FILE]
+       command | textmanip -filter | command
 
   txtmanip is a tool for text manipulation in interactive console with os commands.
 
   Run the txtmanip, starts interactive mode and you can text manipulation. 
   The initial output content is either of a file specified by arguments or standard input.
+  Each file specified by arguments is opened as its own buffer with its own pipeline.
 
   After quit, prints one-liner of generating the same output for your made final result in interactive mode.
 
 Options:
   -config, -c    Set configuration file path (default "txtmanip.toml")
+  -save          Save session file on quit of interactive mode
+  -replay        Apply stages of session file without interactive mode and print the result
+  -resume        Reopen interactive mode from session file
+  -e             Apply command without interactive mode and print the result (repeatable)
+  -large         Map input into memory instead of reading it, which is default for files of 64 MiB or more
+  -sample        Work on sample of input: head:N (first N lines), random:N (N random lines) or every:N (every N-th line)
+  -filter        Print text accepted by Enter with empty input instead of one-liner, which goes to stderr.
+                 Quitting without accepting prints nothing and exits with status 12.
+  -encoding      Set encoding of input, such as SHIFT_JIS, EUC-JP and ISO-8859-1 (default: detected)
 
 Commands in interactive mode:
-  Ctrl+C, Esc    Quit interactive mode
-  Ctrl+Z         Redo text
-  Up, Down       Print history  
 `)
+	for _, a := range defaultKeymap() {
+		fmt.Fprintf(os.Stderr, "  %-22s %s\n", a.KeyNames(), a.Description)
+	}
+	fmt.Fprintln(os.Stderr, "\n  Views and pickers show their own keys in their title. F1 shows this list inside interactive mode.")
 }
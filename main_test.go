@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// newView returns view of buffer of each file on memory screen, whose buffers are closed by closeBuffers
+func newView(t *testing.T, files ...string) (*MainView, *MemoryScreen) {
+	t.Helper()
+	conf, err := LoadConfig(filepath.Join("testdata", "txtmanip.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffers []Buffer
+	for _, f := range files {
+		source, encoding, _, err := openSource(conf, f, false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffers = append(buffers, Buffer{pipeline: conf.NewPipeline(source), encoding: encoding})
+	}
+
+	screen := NewMemoryScreen(60, 12)
+	return NewMainView(screen, buffers, conf, DefaultSessionPath), screen
+}
+
+// closeBuffers closes pipelines of buffers of view
+func closeBuffers(v *MainView) {
+	for _, b := range v.buffers {
+		b.pipeline.Close()
+	}
+}
+
+// runScript drives interactive mode on file by events, and returns screen, stages and one-liner after quit
+func runScript(t *testing.T, file string, events ...termbox.Event) string {
+	t.Helper()
+	v, screen := newView(t, file)
+	defer closeBuffers(v)
+	v.Run(NewScriptedEvents(events...))
+	v.Close()
+
+	return fmt.Sprintf("-- screen --\n%s-- stages --\n%s\n-- one-liner --\n%s\n",
+		screen, strings.Join(v.Pipeline().Commands(), "\n"), strings.Join(v.OneLiners(), "\n"))
+}
+
+// script returns events of typing each string, where keys are written as in macros such as "<Enter>"
+func script(t *testing.T, keys string) []termbox.Event {
+	t.Helper()
+	events, err := decodeKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// checkGolden compares got with golden file of name, or updates it with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from golden file\n--- got\n%s--- want\n%s", name, got, want)
+	}
+}
+
+func TestInteractiveMode(t *testing.T) {
+	cases := []struct {
+		name string
+		keys string
+	}{
+		{"run", "sort<Enter>uniq -c<Enter>"},
+		{"undo", "grep a<Enter>sort -r<Enter><Ctrl+Z>"},
+		{"redo", "grep a<Enter>sort -r<Enter><Ctrl+Z><Ctrl+Y>"},
+		{"history", "head -2<Enter><Ctrl+Z><Up>"},
+		{"not-enabled", "cat -n<Enter>"},
+		{"edit-input", "srt<Left><Left>o<Ctrl+E> -k2n<Enter>"},
+		// Unbalanced quote of action other than invoking command is shown instead of ending interactive mode
+		{"environment-parse-error", `LC_ALL="C<Ctrl+G>`},
+		// Command line which cannot be parsed is shown, and kept for editing
+		{"unbalanced-double-quote", `grep "a<Enter>`},
+		{"unbalanced-single-quote", "grep 'an<Enter>'<Enter>"},
+		// Shell operator without shell executor is shown, and command line is kept for editing
+		{"shell-operator", "sort | head -1<Enter>" + strings.Repeat("<Backspace>", len(" | head -1")) + "<Enter>"},
+		// Bookmark picker is closed when its bookmarks are discarded by command invoked behind it
+		{"bookmark-discarded", "sort<Enter>s<Ctrl+K><Ctrl+Z><Ctrl+L>head -1<Ctrl+X><Enter><Tab>"},
+		// Keys other than editing pattern are ignored by regex workbench, and Enter makes stage of it
+		{"regex-bench", "sort<Enter><F10>p<Ctrl+U><F1><F11><F12><Ctrl+Z><Ctrl+J><Ctrl+V><Up>l+<Left><Backspace><Enter>"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkGolden(t, c.name, runScript(t, filepath.Join("testdata", "input.txt"), script(t, c.keys)...))
+		})
+	}
+}
+
+func TestSessionBuffers(t *testing.T) {
+	input := filepath.Join("testdata", "input.txt")
+	v, _ := newView(t, input, input)
+	defer closeBuffers(v)
+	v.Run(NewScriptedEvents(script(t, "sort<Enter>head -2<Enter><Ctrl+Z><Ctrl+N>grep an<Enter>uniq")...))
+	v.Close()
+
+	dir, err := ioutil.TempDir("", "txtmanip-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.toml")
+	if err := NewSession(v).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, _ := newView(t, input, input)
+	defer closeBuffers(resumed)
+	if warnings := s.Restore(resumed); len(warnings) > 0 {
+		t.Errorf("warnings: %q", warnings)
+	}
+
+	if resumed.current != 1 {
+		t.Errorf("current buffer = %d, want 1", resumed.current)
+	}
+	want := []string{"cat 'testdata/input.txt' | sort", "cat 'testdata/input.txt' | grep an"}
+	if got := resumed.OneLiners(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("one-liners = %q, want %q", got, want)
+	}
+	if got := resumed.buffers[0].pipeline.UndoneCommands(); len(got) != 1 || got[0] != "head -2" {
+		t.Errorf("redo of buffer 1 = %q, want %q", got, []string{"head -2"})
+	}
+	if got := string(resumed.inputArea.text); got != "uniq" {
+		t.Errorf("input = %q, want %q", got, "uniq")
+	}
+}
+
+func TestLoadSessionSingleBuffer(t *testing.T) {
+	s, err := LoadSession(filepath.Join("testdata", "session-single-buffer.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Buffers) != 1 {
+		t.Fatalf("buffers = %d, want 1", len(s.Buffers))
+	}
+	b := s.Buffers[0]
+	if b.Source != "testdata/input.txt" || strings.Join(b.Stages, "\n") != "sort\nuniq -c" || len(b.Bookmarks) != 1 {
+		t.Errorf("buffer = %+v", b)
+	}
+	if s.Input.Text != "head" || len(s.History) != 2 {
+		t.Errorf("input = %+v, history = %q", s.Input, s.History)
+	}
+}
+
+func TestLoadConfigExecutor(t *testing.T) {
+	cases := []struct {
+		config  string
+		wantErr string
+	}{
+		{"[executors.path]\ntype = \"builtin\"\n", ""},
+		{"[executors.grep]\ntype = \"builtin\"\n", "executor of grep: not a built-in stage"},
+		{"[executors.cat]\ntype = \"isolated\"\n", "executor of cat: root or dir is required"},
+	}
+	for _, c := range cases {
+		f, err := ioutil.TempFile("", "txtmanip-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(c.config)
+		f.Close()
+
+		_, err = LoadConfig(f.Name())
+		os.Remove(f.Name())
+		if c.wantErr == "" && err != nil || c.wantErr != "" && (err == nil || err.Error() != c.wantErr) {
+			t.Errorf("LoadConfig(%q) error = %v, want %q", c.config, err, c.wantErr)
+		}
+	}
+}
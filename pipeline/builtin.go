@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BuiltinPrefix is prefix of built-in stage, which runs in-process instead of OS command
+const BuiltinPrefix = ":"
+
+// BuiltinFunc is implementation of built-in stage
+type BuiltinFunc func(args []string, input []byte) ([]byte, error)
+
+// builtins are built-in stages by name
+var builtins = map[string]BuiltinFunc{
+	"path": pathStage,
+}
+
+// Builtins returns names of built-in stages in order
+func Builtins() []string {
+	var names []string
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterBuiltin adds built-in stage invoked by BuiltinPrefix followed by name
+func RegisterBuiltin(name string, f BuiltinFunc) {
+	builtins[name] = f
+}
+
+// runBuiltin invokes built-in stage named by args[0] with or without BuiltinPrefix
+func runBuiltin(args []string, input []byte) ([]byte, error) {
+	name := strings.TrimPrefix(args[0], BuiltinPrefix)
+	f, ok := builtins[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a built-in stage", name)
+	}
+	return f(args[1:], input)
+}
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encodings detected by DetectEncoding, named as iconv accepts
+const (
+	EncodingUTF8     = "UTF-8"
+	EncodingShiftJIS = "SHIFT_JIS"
+	EncodingEUCJP    = "EUC-JP"
+	EncodingLatin1   = "ISO-8859-1"
+)
+
+// DetectEncoding guesses encoding of text among UTF-8, Shift_JIS, EUC-JP and Latin-1
+func DetectEncoding(text []byte) string {
+	if utf8.Valid(text) {
+		return EncodingUTF8
+	}
+
+	sjis, euc := validShiftJIS(text), validEUCJP(text)
+	switch {
+	case sjis && euc:
+		// Lead bytes of Shift_JIS in 0x81-0x9F never appear in EUC-JP except single shifts
+		for _, c := range text {
+			if c >= 0x81 && c <= 0x9f && c != 0x8e && c != 0x8f {
+				return EncodingShiftJIS
+			}
+		}
+		return EncodingEUCJP
+	case sjis:
+		return EncodingShiftJIS
+	case euc:
+		return EncodingEUCJP
+	}
+	return EncodingLatin1
+}
+
+// IsUTF8 reports whether encoding name is UTF-8 or its subset, which needs no conversion
+func IsUTF8(encoding string) bool {
+	switch strings.ToUpper(encoding) {
+	case "", "UTF-8", "UTF8", "ASCII", "US-ASCII":
+		return true
+	}
+	return false
+}
+
+func validShiftJIS(text []byte) bool {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c < 0x80, c >= 0xa1 && c <= 0xdf:
+		case c >= 0x81 && c <= 0x9f, c >= 0xe0 && c <= 0xfc:
+			if i+1 >= len(text) {
+				return false
+			}
+			i++
+			if t := text[i]; t < 0x40 || t == 0x7f || t > 0xfc {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validEUCJP(text []byte) bool {
+	isEUC := func(c byte) bool { return c >= 0xa1 && c <= 0xfe }
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c < 0x80:
+		case c == 0x8e:
+			if i+1 >= len(text) || text[i+1] < 0xa1 || text[i+1] > 0xdf {
+				return false
+			}
+			i++
+		case c == 0x8f:
+			if i+2 >= len(text) || !isEUC(text[i+1]) || !isEUC(text[i+2]) {
+				return false
+			}
+			i += 2
+		case isEUC(c):
+			if i+1 >= len(text) || !isEUC(text[i+1]) {
+				return false
+			}
+			i++
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ConvertToUTF8 converts text in encoding into UTF-8 by iconv.
+// When lossy is true, bytes which cannot be converted are dropped instead of failing.
+func ConvertToUTF8(text []byte, encoding string, lossy bool) ([]byte, error) {
+	if IsUTF8(encoding) {
+		return text, nil
+	}
+
+	args := []string{"-f", encoding, "-t", EncodingUTF8}
+	if lossy {
+		args = append(args, "-c")
+	}
+	cmd := exec.Command("iconv", args...)
+	cmd.Stdin = bytes.NewReader(text)
+
+	out, err := cmd.Output()
+	if err != nil {
+		// iconv -c may exit with failure even when it dropped invalid bytes as requested
+		if lossy && len(out) > 0 {
+			return out, nil
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// IconvStage returns stage converting encoding into UTF-8 in one-liner
+func IconvStage(encoding string) string {
+	return "iconv -f " + ShellQuote(encoding) + " -t " + EncodingUTF8
+}
@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// Environment represents environment variables and working directory of commands.
+// Variables not set or unset are inherited from txtmanip.
+type Environment struct {
+	// Set are variables set for commands, such as "LC_ALL": "C"
+	Set map[string]string
+	// Unset are names of variables removed from environment of commands
+	Unset []string
+	// Dir is working directory of commands. Current directory is used when it is empty.
+	Dir string
+}
+
+// Empty reports whether environment is inherited as is
+func (e Environment) Empty() bool {
+	return len(e.Set) == 0 && len(e.Unset) == 0 && e.Dir == ""
+}
+
+// Copy returns environment which does not share Set and Unset with e
+func (e Environment) Copy() Environment {
+	c := Environment{Unset: append([]string{}, e.Unset...), Dir: e.Dir}
+	if len(e.Set) > 0 {
+		c.Set = make(map[string]string)
+		for name, value := range e.Set {
+			c.Set[name] = value
+		}
+	}
+	return c
+}
+
+// names returns names of set variables in order
+func (e Environment) names() []string {
+	var names []string
+	for name := range e.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// environ returns environment of process, or nil to inherit the whole environment
+func (e Environment) environ() []string {
+	if len(e.Set) == 0 && len(e.Unset) == 0 {
+		return nil
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if _, ok := e.Set[name]; ok || e.unset(name) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	for _, name := range e.names() {
+		env = append(env, name+"="+e.Set[name])
+	}
+	return env
+}
+
+func (e Environment) unset(name string) bool {
+	for _, n := range e.Unset {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// prefix returns env command setting variables, followed by space, or empty when no variable is changed
+func (e Environment) prefix() string {
+	if len(e.Set) == 0 && len(e.Unset) == 0 {
+		return ""
+	}
+
+	args := []string{"env"}
+	for _, name := range e.Unset {
+		if _, ok := e.Set[name]; !ok {
+			args = append(args, "-u", ShellQuote(name))
+		}
+	}
+	for _, name := range e.names() {
+		args = append(args, ShellQuote(name+"="+e.Set[name]))
+	}
+	return strings.Join(args, " ") + " "
+}
+
+// wrap returns shell command running line in environment
+func (e Environment) wrap(line string) string {
+	line = e.prefix() + line
+	if e.Dir == "" {
+		return line
+	}
+	return fmt.Sprintf("(cd %s && %s)", ShellQuote(e.Dir), line)
+}
+
+// String returns environment in the same form as arguments of env command, such as "-u LANG LC_ALL=C -C /tmp"
+func (e Environment) String() string {
+	s := strings.TrimSuffix(strings.TrimPrefix(e.prefix(), "env "), " ")
+	if e.Dir != "" {
+		s = strings.TrimSpace(s + " -C " + ShellQuote(e.Dir))
+	}
+	return s
+}
+
+// ParseEnvironment applies line of arguments in the form of env command to e and returns the result.
+// "NAME=VALUE" sets variable, "-u NAME" unsets it, "NAME" inherits it again and "-C DIR" changes working directory.
+func ParseEnvironment(e Environment, line string) (Environment, error) {
+	args, err := shellwords.Parse(line)
+	if err != nil {
+		return Environment{}, &ParseError{err: err}
+	}
+
+	e = e.Copy()
+	forget := func(name string) {
+		delete(e.Set, name)
+		var unset []string
+		for _, n := range e.Unset {
+			if n != name {
+				unset = append(unset, n)
+			}
+		}
+		e.Unset = unset
+	}
+
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "-u" || a == "-C":
+			if i+1 >= len(args) {
+				return Environment{}, fmt.Errorf("%s requires argument", a)
+			}
+			i++
+			if a == "-C" {
+				e.Dir = args[i]
+				if e.Dir == "." {
+					e.Dir = ""
+				}
+				continue
+			}
+			forget(args[i])
+			e.Unset = append(e.Unset, args[i])
+		case strings.HasPrefix(a, "-"):
+			return Environment{}, fmt.Errorf("unknown option %s", a)
+		case strings.Contains(a, "="):
+			kv := strings.SplitN(a, "=", 2)
+			if kv[0] == "" {
+				return Environment{}, fmt.Errorf("invalid variable %s", a)
+			}
+			forget(kv[0])
+			if e.Set == nil {
+				e.Set = make(map[string]string)
+			}
+			e.Set[kv[0]] = kv[1]
+		default:
+			forget(a)
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Command represents command line of stage
+type Command struct {
+	// Line is command line as typed
+	Line string
+	// Args is Line split into words
+	Args []string
+	// Env is environment variables and working directory of command
+	Env Environment
+}
+
+// Name returns command name, which is the first word of command line
+func (c Command) Name() string {
+	return c.Args[0]
+}
+
+// Status represents exit status of command
+type Status struct {
+	// Code is exit status, or -1 when the command was terminated by signal
+	Code int
+	// Signal is name of signal which terminated the command, such as "killed"
+	Signal string
+}
+
+// ExitError represents command exited with non-zero status or terminated by signal
+type ExitError struct {
+	Status
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return strings.TrimSpace(fmt.Sprintf("terminated by signal (%s) %s", e.Signal, e.Stderr))
+	}
+	if e.Stderr == "" {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Stderr
+}
+
+// Executor executes command reading stdin and writing output to stdout.
+// Execute stops the command and returns error of ctx when ctx is done.
+type Executor interface {
+	Execute(ctx context.Context, c Command, stdin io.Reader, stdout io.Writer) (Status, error)
+	// Shell returns shell command generating the same output in one-liner
+	Shell(c Command) string
+}
+
+// ExecExecutor executes command directly as OS process
+type ExecExecutor struct{}
+
+// Execute executes the first word of command with the rest as arguments
+func (ExecExecutor) Execute(ctx context.Context, c Command, stdin io.Reader, stdout io.Writer) (Status, error) {
+	cmd := exec.Command(c.Args[0], c.Args[1:]...)
+	cmd.Env, cmd.Dir = c.Env.environ(), c.Env.Dir
+	return run(ctx, cmd, stdin, stdout)
+}
+
+// Shell returns command line as is, with env and cd for environment of command
+func (ExecExecutor) Shell(c Command) string {
+	return c.Env.wrap(c.Line)
+}
+
+// ShellExecutor executes command line by shell, so that shell syntax such as pipes and globs can be used.
+// Only the first word of command line is checked by policy, so that any command can be run through the shell.
+type ShellExecutor struct {
+	// Path is shell path. "sh" is used when it is empty.
+	Path string
+}
+
+func (e ShellExecutor) path() string {
+	if e.Path == "" {
+		return "sh"
+	}
+	return e.Path
+}
+
+// Execute executes command line with "-c" option of shell
+func (e ShellExecutor) Execute(ctx context.Context, c Command, stdin io.Reader, stdout io.Writer) (Status, error) {
+	cmd := exec.Command(e.path(), "-c", c.Line)
+	cmd.Env, cmd.Dir = c.Env.environ(), c.Env.Dir
+	return run(ctx, cmd, stdin, stdout)
+}
+
+// Shell returns command line passed to shell
+func (e ShellExecutor) Shell(c Command) string {
+	return c.Env.wrap(fmt.Sprintf("%s -c %s", ShellQuote(e.path()), ShellQuote(c.Line)))
+}
+
+// BuiltinExecutor executes built-in stage of command name in-process.
+// Environment of command is not used.
+type BuiltinExecutor struct{}
+
+// Execute invokes built-in stage
+func (BuiltinExecutor) Execute(ctx context.Context, c Command, stdin io.Reader, stdout io.Writer) (Status, error) {
+	input, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return Status{}, err
+	}
+	out, err := runBuiltin(c.Args, input)
+	if err != nil {
+		return Status{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return Status{}, err
+	}
+	_, err = stdout.Write(out)
+	return Status{}, err
+}
+
+// Shell returns command line running the built-in stage by headless mode of txtmanip
+func (BuiltinExecutor) Shell(c Command) string {
+	line := strings.TrimSpace(c.Line)
+	if !strings.HasPrefix(line, BuiltinPrefix) {
+		line = BuiltinPrefix + line
+	}
+	return fmt.Sprintf("txtmanip -c /dev/null -e %s", DoubleQuote(line))
+}
+
+// IsolatedExecutor executes command as OS process in a chroot or a different working directory.
+// Chroot requires privilege to change root directory.
+// Working directory of environment of command is not used.
+type IsolatedExecutor struct {
+	// Root is root directory of process. The root is not changed when it is empty.
+	Root string
+	// Dir is working directory of process, which is inside Root when Root is set
+	Dir string
+}
+
+// Execute executes the first word of command with the rest as arguments
+func (e IsolatedExecutor) Execute(ctx context.Context, c Command, stdin io.Reader, stdout io.Writer) (Status, error) {
+	if e.Root == "" {
+		cmd := exec.Command(c.Args[0], c.Args[1:]...)
+		cmd.Env, cmd.Dir = c.Env.environ(), e.Dir
+		return run(ctx, cmd, stdin, stdout)
+	}
+
+	path, err := lookPathIn(e.Root, c.Args[0])
+	if err != nil {
+		return Status{}, err
+	}
+	cmd := &exec.Cmd{Path: path, Args: c.Args, Env: c.Env.environ(), Dir: e.Dir}
+	if cmd.Dir == "" {
+		// Same as chroot(1)
+		cmd.Dir = "/"
+	}
+	if cmd.SysProcAttr, err = chrootAttr(e.Root); err != nil {
+		return Status{}, err
+	}
+	return run(ctx, cmd, stdin, stdout)
+}
+
+// Shell returns command line wrapped with chroot and cd
+func (e IsolatedExecutor) Shell(c Command) string {
+	line := c.Env.prefix() + c.Line
+	switch {
+	case e.Root == "":
+		return fmt.Sprintf("(cd %s && %s)", ShellQuote(e.Dir), line)
+	case e.Dir == "":
+		return fmt.Sprintf("chroot %s %s", ShellQuote(e.Root), line)
+	default:
+		return fmt.Sprintf("chroot %s sh -c %s", ShellQuote(e.Root), ShellQuote(fmt.Sprintf("cd %s && %s", ShellQuote(e.Dir), line)))
+	}
+}
+
+// lookPathIn searches PATH for command name inside root, and returns its path seen from inside root
+func lookPathIn(root, name string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(filepath.Join(root, path)); err == nil && !fi.IsDir() && fi.Mode()&0111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not found in %s", name, root)
+}
+
+// run runs cmd reading stdin and writing output to stdout.
+// When the command exits with non-zero status or is terminated by signal, ExitError with its stderr is returned.
+// stdin of *os.File, such as mapped source file, is passed to the process as is.
+// The process is killed when ctx is done.
+func run(ctx context.Context, cmd *exec.Cmd, stdin io.Reader, stdout io.Writer) (Status, error) {
+	var stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, &stderr
+
+	if err := cmd.Start(); err != nil {
+		return Status{}, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+	err := cmd.Wait()
+	close(exited)
+	if ctx.Err() != nil {
+		return Status{Code: -1}, ctx.Err()
+	}
+
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return Status{}, err
+		}
+		status := Status{Code: -1}
+		if ws, ok := exitErr.ProcessState.Sys().(syscall.WaitStatus); ok {
+			status.Code = ws.ExitStatus()
+			if ws.Signaled() {
+				status.Signal = ws.Signal().String()
+			}
+		}
+		return status, &ExitError{Status: status, Stderr: stderr.String()}
+	}
+
+	return Status{}, nil
+}
@@ -0,0 +1,289 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kinds of path step
+const (
+	stepKey = iota
+	stepIndex
+	stepIter
+)
+
+type pathStep struct {
+	kind  int
+	key   string
+	index int
+}
+
+// Member represents member of JSON object
+type Member struct {
+	Key   string
+	Value json.RawMessage
+}
+
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parsePath parses subset of jq path expression, such as .items[0].name, .["a key"] and .items[]
+func parsePath(p string) ([]pathStep, error) {
+	var steps []pathStep
+
+	s := strings.TrimSpace(p)
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("path must start with '.': %s", p)
+	}
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, ".["), strings.HasPrefix(s, "["):
+			s = strings.TrimPrefix(s, ".")
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']' in path: %s", p)
+			}
+			inner := s[1:end]
+			switch {
+			case inner == "":
+				steps = append(steps, pathStep{kind: stepIter})
+			case strings.HasPrefix(inner, `"`):
+				key, err := strconv.Unquote(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid key in path: %s", inner)
+				}
+				steps = append(steps, pathStep{kind: stepKey, key: key})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in path: %s", inner)
+				}
+				steps = append(steps, pathStep{kind: stepIndex, index: n})
+			}
+			s = s[end+1:]
+		case s == ".":
+			s = ""
+		case strings.HasPrefix(s, "."):
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if !identRe.MatchString(s[:end]) {
+				return nil, fmt.Errorf("invalid key in path: %s", s[:end])
+			}
+			steps = append(steps, pathStep{kind: stepKey, key: s[:end]})
+			s = s[end:]
+		default:
+			return nil, fmt.Errorf("invalid path: %s", p)
+		}
+	}
+	return steps, nil
+}
+
+// PathKey returns path step for key in jq syntax
+func PathKey(key string) string {
+	if identRe.MatchString(key) {
+		return "." + key
+	}
+	return fmt.Sprintf(".[%s]", strconv.Quote(key))
+}
+
+// evalPath returns values selected by steps from JSON value.
+// Members of objects keep their order.
+func evalPath(raw json.RawMessage, steps []pathStep) ([]json.RawMessage, error) {
+	values := []json.RawMessage{raw}
+	for _, step := range steps {
+		var next []json.RawMessage
+		for _, v := range values {
+			// Indexing null results in null like jq
+			if step.kind != stepIter && JSONKind(v) == "null" {
+				next = append(next, v)
+				continue
+			}
+			switch step.kind {
+			case stepKey:
+				members, err := ObjectMembers(v)
+				if err != nil {
+					return nil, fmt.Errorf("cannot index %s with %q", JSONKind(v), step.key)
+				}
+				value := json.RawMessage("null")
+				for _, m := range members {
+					if m.Key == step.key {
+						value = m.Value
+					}
+				}
+				next = append(next, value)
+			case stepIndex:
+				var elems []json.RawMessage
+				if err := json.Unmarshal(v, &elems); err != nil {
+					return nil, fmt.Errorf("cannot index %s with number", JSONKind(v))
+				}
+				n := step.index
+				if n < 0 {
+					n += len(elems)
+				}
+				if n < 0 || n >= len(elems) {
+					next = append(next, json.RawMessage("null"))
+					continue
+				}
+				next = append(next, elems[n])
+			case stepIter:
+				if members, err := ObjectMembers(v); err == nil {
+					for _, m := range members {
+						next = append(next, m.Value)
+					}
+					continue
+				}
+				var elems []json.RawMessage
+				if err := json.Unmarshal(v, &elems); err != nil {
+					return nil, fmt.Errorf("cannot iterate over %s", JSONKind(v))
+				}
+				next = append(next, elems...)
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// ObjectMembers returns members of JSON object in order
+func ObjectMembers(raw json.RawMessage) ([]Member, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, errors.New("not an object")
+	}
+
+	var members []Member
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		members = append(members, Member{Key: tok.(string), Value: value})
+	}
+	return members, nil
+}
+
+// JSONKind returns kind of JSON value, such as object and string
+func JSONKind(raw json.RawMessage) string {
+	switch c := FirstByte(raw); {
+	case c == '{':
+		return "object"
+	case c == '[':
+		return "array"
+	case c == '"':
+		return "string"
+	case c == 't', c == 'f':
+		return "boolean"
+	case c == 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// FirstByte returns first byte except white spaces, or 0 for blank
+func FirstByte(raw []byte) byte {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) < 1 {
+		return 0
+	}
+	return raw[0]
+}
+
+// JSONError represents invalid JSON with its position
+type JSONError struct {
+	Line   int
+	Column int
+	err    error
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("invalid JSON at line %d, column %d: %s", e.Line, e.Column, e.err.Error())
+}
+
+// DecodeJSONValues decodes text as JSON or JSON Lines, which is a stream of JSON values
+func DecodeJSONValues(text []byte) ([]json.RawMessage, error) {
+	var values []json.RawMessage
+
+	dec := json.NewDecoder(bytes.NewReader(text))
+	for {
+		var v json.RawMessage
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			offset := dec.InputOffset()
+			if se, ok := err.(*json.SyntaxError); ok && se.Offset > 0 {
+				// Offset is after the byte caused the error
+				offset = se.Offset - 1
+			} else if err == io.ErrUnexpectedEOF {
+				// Value is not closed until the end of input, where trailing spaces are not counted
+				offset = int64(len(bytes.TrimRight(text, " \t\r\n")))
+			}
+			line, col := lineColumn(text, offset)
+			return nil, &JSONError{Line: line, Column: col, err: err}
+		}
+		values = append(values, v)
+	}
+	if len(values) < 1 {
+		return nil, errors.New("no JSON value")
+	}
+	return values, nil
+}
+
+// lineColumn returns 1-based line and column of byte offset in text
+func lineColumn(text []byte, offset int64) (int, int) {
+	if offset > int64(len(text)) {
+		offset = int64(len(text))
+	}
+	before := text[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// pathStage is built-in stage that applies path expression to each JSON value of input, like jq
+func pathStage(args []string, input []byte) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: :path PATH")
+	}
+	steps, err := parsePath(args[0])
+	if err != nil {
+		return nil, err
+	}
+	values, err := DecodeJSONValues(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	for _, v := range values {
+		results, err := evalPath(v, steps)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			if err := json.Indent(&out, r, "", "  "); err != nil {
+				return nil, err
+			}
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes(), nil
+}
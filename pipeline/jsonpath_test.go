@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"testing"
+)
+
+func TestPathStage(t *testing.T) {
+	input := `{"items":[{"name":"a","tags":["x"]},{"name":"b","a key":1}]}
+{"items":null}
+`
+	cases := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{".items[0].name", "\"a\"\nnull\n", ""},
+		{".items[].name", "\"a\"\n\"b\"\n", ""},
+		{`.items[1].["a key"]`, "1\nnull\n", ""},
+		{".items[0].tags", "[\n  \"x\"\n]\nnull\n", ""},
+		{"items", "", "path must start with '.': items"},
+		{".items[0", "", "missing ']' in path: .items[0"},
+		{".items[x]", "", "invalid index in path: x"},
+	}
+	for _, c := range cases {
+		got, err := pathStage([]string{c.path}, []byte(input))
+		if c.wantErr != "" {
+			if err == nil || err.Error() != c.wantErr {
+				t.Errorf("%s: error = %v, want %q", c.path, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", c.path, err)
+			continue
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: output = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
+
+func TestDecodeJSONValuesError(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"{\"a\":1}\n{\"b\":2\n", "invalid JSON at line 2, column 7: unexpected EOF"},
+		{`{"a":[1,2`, "invalid JSON at line 1, column 10: unexpected EOF"},
+		{"{\"a\":1}\n{\"b\":x}\n", "invalid JSON at line 2, column 6: invalid character 'x' looking for beginning of value"},
+		{"[1,2]\n  ]", "invalid JSON at line 2, column 3: invalid character ']' looking for beginning of value"},
+	}
+	for _, c := range cases {
+		_, err := DecodeJSONValues([]byte(c.input))
+		if err == nil || err.Error() != c.want {
+			t.Errorf("DecodeJSONValues(%q) error = %v, want %q", c.input, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,513 @@
+// Package pipeline provides stage execution, allowlist checks and one-liner generation of txtmanip.
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// Source represents input of pipeline
+type Source struct {
+	// Name is file path of source, or empty for standard input
+	Name string
+	Text []byte
+	// Encoding is encoding of the file which Text has been converted from into UTF-8.
+	// It is empty when Text is not converted.
+	Encoding string
+	// Path is file which Text is mapped from. First stage reads the file instead of Text when it is set.
+	Path string
+
+	// temporary is true when Path is spooled from standard input
+	temporary bool
+}
+
+// MapSource returns source mapped from file into memory, so that text is not copied.
+// Standard input is spooled into temporary file when name is empty.
+func MapSource(name string, f *os.File) (Source, error) {
+	if name != "" {
+		text, err := mapFile(f)
+		if err != nil {
+			return Source{}, err
+		}
+		return Source{Name: name, Text: text, Path: f.Name()}, nil
+	}
+
+	tmp, text, err := spool(func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return Source{}, err
+	}
+	return Source{Text: text, Path: tmp, temporary: true}, nil
+}
+
+// Close releases text mapped from file, and removes file spooled from standard input
+func (s Source) Close() {
+	if s.Path == "" {
+		return
+	}
+	unmapFile(s.Text)
+	if s.temporary {
+		os.Remove(s.Path)
+	}
+}
+
+// spool writes output into temporary file and maps it into memory
+func spool(write func(w io.Writer) error) (string, []byte, error) {
+	f, err := ioutil.TempFile("", "txtmanip-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	err = write(f)
+	var text []byte
+	if err == nil {
+		text, err = mapFile(f)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", nil, err
+	}
+	return f.Name(), text, nil
+}
+
+// Stage represents command applied to text and its output
+type Stage struct {
+	Command string
+	// Env is environment which the command ran in
+	Env    Environment
+	Output []byte
+
+	// path is temporary file which Output is mapped from
+	path string
+}
+
+// release unmaps output of spooled stage and removes its file
+func (s Stage) release() {
+	if s.path == "" {
+		return
+	}
+	unmapFile(s.Output)
+	os.Remove(s.path)
+}
+
+// ParseError represents failure of parsing command line
+type ParseError struct {
+	err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprint("parse command failed: ", e.err.Error())
+}
+
+// Pipeline represents stages applied to source in order
+type Pipeline struct {
+	Source Source
+	Policy *Policy
+	// Executor executes commands not contained in Executors
+	Executor Executor
+	// Executors are executors by command name
+	Executors map[string]Executor
+	// Spool writes output of stages into temporary files mapped into memory instead of heap
+	Spool bool
+	// Env is environment of commands run from now on. Stages keep environment which they ran in.
+	Env Environment
+	// AcceptCodes are non-zero exit statuses treated as success by command name.
+	// stderr of the command is returned as warning in that case.
+	AcceptCodes map[string][]int
+
+	stages []Stage
+	// undone are stages reverted by Undo, latest last
+	undone []Stage
+	last   *Result
+}
+
+// DefaultAcceptCodes are exit statuses treated as success by default.
+// "grep" exits with 1 when no lines matched, which is not error.
+var DefaultAcceptCodes = map[string][]int{
+	"grep": {1},
+}
+
+// Result represents result of last command run by pipeline
+type Result struct {
+	Command string
+	// Code is exit status, or -1 when the command could not run or was terminated by signal
+	Code int
+	// Signal is name of signal which terminated the command
+	Signal   string
+	Duration time.Duration
+	// Warn is stderr of command whose failure is tolerated
+	Warn string
+	Err  error
+}
+
+// Last returns result of last command run by pipeline, or nil when no command has run
+func (p *Pipeline) Last() *Result {
+	return p.last
+}
+
+// New returns pipeline of source without stages, which executes commands directly.
+// Output of stages is spooled when source is mapped from file.
+func New(source Source, policy *Policy) *Pipeline {
+	accept := make(map[string][]int)
+	for name, codes := range DefaultAcceptCodes {
+		accept[name] = codes
+	}
+	return &Pipeline{
+		Source:      source,
+		Policy:      policy,
+		Executor:    ExecExecutor{},
+		Spool:       source.Path != "",
+		AcceptCodes: accept,
+	}
+}
+
+// Close releases mapped source and spooled stages
+func (p *Pipeline) Close() {
+	p.release(p.stages)
+	p.release(p.undone)
+	p.stages, p.undone = nil, nil
+	p.Source.Close()
+}
+
+func (p *Pipeline) release(stages []Stage) {
+	for _, s := range stages {
+		s.release()
+	}
+}
+
+// Execute invokes command line with input as stdin and returns its output, without adding stage.
+// warn is not empty when the command failed but the failure is tolerated.
+func (p *Pipeline) Execute(command string, input []byte) (out []byte, warn string, err error) {
+	c, err := p.command(command)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var b bytes.Buffer
+	_, err = p.executor(c).Execute(context.Background(), c, bytes.NewReader(input), &b)
+	if warn, err = p.accept(c, err); err != nil {
+		return nil, "", err
+	}
+	return b.Bytes(), warn, nil
+}
+
+// accept returns stderr of command as warning instead of error when its exit status is in AcceptCodes
+func (p *Pipeline) accept(c Command, err error) (string, error) {
+	e, ok := err.(*ExitError)
+	if !ok || e.Signal != "" {
+		return "", err
+	}
+	for _, code := range p.AcceptCodes[c.Name()] {
+		if e.Code == code {
+			return e.Stderr, nil
+		}
+	}
+	return "", err
+}
+
+// command parses command line and checks it by policy
+func (p *Pipeline) command(line string) (Command, error) {
+	c, pos, err := parseCommand(line)
+	if err != nil {
+		return Command{}, err
+	}
+	// Operators of shell are passed to shell as part of command line
+	if _, ok := p.executor(c).(ShellExecutor); pos >= 0 && !ok {
+		return Command{}, operatorError(line, pos)
+	}
+
+	// Built-in stages are always enabled
+	if !strings.HasPrefix(c.Name(), BuiltinPrefix) && !p.Policy.Allowed(c.Name()) {
+		return Command{}, fmt.Errorf("%s cannot be executed", c.Name())
+	}
+	c.Env = p.Env.Copy()
+	return c, nil
+}
+
+// ParseCommand splits command line into words.
+// Operators of shell such as "|" and ";" cannot be used, since they are executed only by shell.
+func ParseCommand(line string) (Command, error) {
+	c, pos, err := parseCommand(line)
+	if err != nil {
+		return Command{}, err
+	}
+	if pos >= 0 {
+		return Command{}, operatorError(line, pos)
+	}
+	return c, nil
+}
+
+// parseCommand splits command line into words before the first operator of shell, and returns position of the operator or -1
+func parseCommand(line string) (Command, int, error) {
+	parser := shellwords.NewParser()
+	args, err := parser.Parse(line)
+	if err != nil {
+		return Command{}, -1, &ParseError{err: err}
+	}
+	if len(args) < 1 {
+		return Command{}, -1, errors.New("empty command")
+	}
+	return Command{Line: line, Args: args}, parser.Position, nil
+}
+
+// operatorError returns error of operator of shell at pos of command line
+func operatorError(line string, pos int) error {
+	return &ParseError{err: fmt.Errorf("%q cannot be used without shell executor", line[pos])}
+}
+
+// executor returns executor selected for command
+func (p *Pipeline) executor(c Command) Executor {
+	if strings.HasPrefix(c.Name(), BuiltinPrefix) {
+		return BuiltinExecutor{}
+	}
+	if e, ok := p.Executors[c.Name()]; ok {
+		return e
+	}
+	return p.Executor
+}
+
+// Run invokes command on current text and adds it as stage.
+// Stages reverted by Undo are discarded.
+func (p *Pipeline) Run(command string) (warn string, err error) {
+	s, r := p.run(context.Background(), command, nil)
+	return p.commit(s, r)
+}
+
+// commit records result of command and adds its stage when it succeeded
+func (p *Pipeline) commit(s Stage, r *Result) (string, error) {
+	p.last = r
+	if r.Err != nil {
+		return "", r.Err
+	}
+
+	p.stages = append(p.stages, s)
+	p.release(p.undone)
+	p.undone = nil
+	return r.Warn, nil
+}
+
+// Job represents command started by Start, running on current text in background
+type Job struct {
+	p      *Pipeline
+	cancel context.CancelFunc
+	done   chan struct{}
+	stage  Stage
+	result *Result
+}
+
+// Start invokes command on current text in background, also writing its output to w as it arrives.
+// Pipeline must not be changed until the job is committed by Wait.
+func (p *Pipeline) Start(command string, w io.Writer) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{p: p, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		j.stage, j.result = p.run(ctx, command, w)
+		close(j.done)
+	}()
+	return j
+}
+
+// Done returns channel closed when command of job exits
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Cancel stops command of job. Wait returns context.Canceled and no stage is added.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Wait waits for command of job, and adds it as stage in the same way as Run
+func (j *Job) Wait() (warn string, err error) {
+	<-j.done
+	j.cancel()
+	return j.p.commit(j.stage, j.result)
+}
+
+// RunAll invokes commands in order and adds them as stages.
+// When a command fails, stages added by RunAll are removed and stages reverted by Undo are kept.
+func (p *Pipeline) RunAll(commands []string) error {
+	n := len(p.stages)
+	for i, c := range commands {
+		s, r := p.run(context.Background(), c, nil)
+		p.last = r
+		if r.Err != nil {
+			p.release(p.stages[n:])
+			p.stages = p.stages[:n]
+			return fmt.Errorf("stage %d (%s) failed: %s", i+1, c, r.Err.Error())
+		}
+		p.stages = append(p.stages, s)
+	}
+
+	p.release(p.undone)
+	p.undone = nil
+	return nil
+}
+
+// run invokes command on current text and returns new stage and result without changing pipeline.
+// Output is also written to tee unless it is nil.
+func (p *Pipeline) run(ctx context.Context, command string, tee io.Writer) (Stage, *Result) {
+	c, err := p.command(command)
+	if err != nil {
+		return Stage{}, &Result{Command: command, Code: -1, Err: err}
+	}
+	stdin, err := p.reader()
+	if err != nil {
+		return Stage{}, &Result{Command: command, Code: -1, Err: err}
+	}
+	defer stdin.Close()
+
+	// Exit status is accepted before spooling, so that output of accepted command is kept
+	var status Status
+	var warn string
+	execute := func(w io.Writer) error {
+		if tee != nil {
+			w = io.MultiWriter(w, tee)
+		}
+		var err error
+		status, err = p.executor(c).Execute(ctx, c, stdin, w)
+		warn, err = p.accept(c, err)
+		return err
+	}
+
+	s := Stage{Command: command, Env: c.Env}
+	start := time.Now()
+	if p.Spool {
+		s.path, s.Output, err = spool(execute)
+	} else {
+		var b bytes.Buffer
+		err = execute(&b)
+		s.Output = b.Bytes()
+	}
+	r := &Result{Command: command, Code: status.Code, Signal: status.Signal, Duration: time.Since(start), Warn: warn, Err: err}
+	if _, ok := err.(*ExitError); err != nil && !ok {
+		r.Code = -1
+	}
+	return s, r
+}
+
+// reader returns reader of current text, which reads file directly when text is mapped from it
+func (p *Pipeline) reader() (io.ReadCloser, error) {
+	path := p.Source.Path
+	if n := len(p.stages); n > 0 {
+		path = p.stages[n-1].path
+	}
+	if path == "" {
+		return ioutil.NopCloser(bytes.NewReader(p.Text())), nil
+	}
+	return os.Open(path)
+}
+
+// Undo reverts last stage. It reports false when there is no stage.
+func (p *Pipeline) Undo() bool {
+	if len(p.stages) < 1 {
+		return false
+	}
+	p.undone = append(p.undone, p.stages[len(p.stages)-1])
+	p.stages = p.stages[:len(p.stages)-1]
+	return true
+}
+
+// Redo restores stage reverted by Undo. It reports false when there is no reverted stage.
+func (p *Pipeline) Redo() bool {
+	if len(p.undone) < 1 {
+		return false
+	}
+	p.stages = append(p.stages, p.undone[len(p.undone)-1])
+	p.undone = p.undone[:len(p.undone)-1]
+	return true
+}
+
+// Seek undoes or redoes stages until number of stages is n, so that stages after n can be restored by Redo.
+// It reports false when n exceeds number of stages and stages reverted by Undo.
+func (p *Pipeline) Seek(n int) bool {
+	if n < 0 || n > len(p.stages)+len(p.undone) {
+		return false
+	}
+	for len(p.stages) > n {
+		p.Undo()
+	}
+	for len(p.stages) < n {
+		p.Redo()
+	}
+	return true
+}
+
+// Len returns number of stages
+func (p *Pipeline) Len() int {
+	return len(p.stages)
+}
+
+// Undone returns number of stages reverted by Undo, which can be restored by Redo
+func (p *Pipeline) Undone() int {
+	return len(p.undone)
+}
+
+// UndoneCommands returns commands of stages reverted by Undo, in order of Redo
+func (p *Pipeline) UndoneCommands() []string {
+	var commands []string
+	for n := len(p.undone) - 1; n >= 0; n-- {
+		commands = append(commands, p.undone[n].Command)
+	}
+	return commands
+}
+
+// Text returns output of last stage, or source text when there is no stage
+func (p *Pipeline) Text() []byte {
+	return p.Snapshot(len(p.stages))
+}
+
+// Snapshot returns text after n stages. Snapshot(0) is source text.
+func (p *Pipeline) Snapshot(n int) []byte {
+	if n == 0 {
+		return p.Source.Text
+	}
+	return p.stages[n-1].Output
+}
+
+// Stages returns stages in order
+func (p *Pipeline) Stages() []Stage {
+	return append([]Stage{}, p.stages...)
+}
+
+// Commands returns commands of stages in order
+func (p *Pipeline) Commands() []string {
+	var commands []string
+	for _, s := range p.stages {
+		commands = append(commands, s.Command)
+	}
+	return commands
+}
+
+// Shell returns one-liner that generates the same output as stages
+func (p *Pipeline) Shell() string {
+	var base string
+	if p.Source.Name == "" {
+		base = "<source>"
+	} else {
+		base = fmt.Sprintf("cat %s", ShellQuote(p.Source.Name))
+	}
+	commands := []string{base}
+	if !IsUTF8(p.Source.Encoding) {
+		commands = append(commands, IconvStage(p.Source.Encoding))
+	}
+	for _, s := range p.stages {
+		// Command of stage has been parsed successfully when it ran
+		c, _, _ := parseCommand(s.Command)
+		c.Env = s.Env
+		commands = append(commands, p.executor(c).Shell(c))
+	}
+	return strings.Join(commands, " | ")
+}
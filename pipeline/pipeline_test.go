@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		line    string
+		args    []string
+		wantErr string
+	}{
+		{"sort -k2n", []string{"sort", "-k2n"}, ""},
+		{`grep -e 'a b' "x|y"`, []string{"grep", "-e", "a b", "x|y"}, ""},
+		{`grep -v x | sort`, nil, `parse command failed: '|' cannot be used without shell executor`},
+		{`sort; rm x`, nil, `parse command failed: ';' cannot be used without shell executor`},
+		{`sed 's/a/b/`, nil, "parse command failed: invalid command line string"},
+		{" ", nil, "empty command"},
+	}
+	for _, c := range cases {
+		got, err := ParseCommand(c.line)
+		if c.wantErr != "" {
+			if err == nil || err.Error() != c.wantErr {
+				t.Errorf("ParseCommand(%q) error = %v, want %q", c.line, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCommand(%q) error = %v", c.line, err)
+			continue
+		}
+		if strings.Join(got.Args, "\n") != strings.Join(c.args, "\n") {
+			t.Errorf("ParseCommand(%q) = %q, want %q", c.line, got.Args, c.args)
+		}
+	}
+}
+
+func TestExecuteOperator(t *testing.T) {
+	var lines []string
+	p := New(Source{}, &Policy{EnableCommands: []string{"grep", "sh"}})
+	p.Executor = fakeExecutor{output: "x", lines: &lines}
+	p.Executors = map[string]Executor{"sh": ShellExecutor{}}
+
+	// Exec executor would run only the command before operator
+	if _, _, err := p.Execute("grep -v x | sort", nil); err == nil {
+		t.Error("command line with operator is executed without shell executor")
+	} else if _, ok := err.(*ParseError); !ok {
+		t.Errorf("error = %T, want *ParseError", err)
+	}
+	if len(lines) > 0 {
+		t.Errorf("executed %q", lines)
+	}
+
+	out, _, err := p.Execute("sh | tr a-z A-Z", []byte("echo abc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "ABC\n" {
+		t.Errorf("output = %q, want %q", out, "ABC\n")
+	}
+}
+
+func TestShell(t *testing.T) {
+	p := New(Source{Name: "in.txt", Text: []byte("b\na\n")}, &Policy{EnableCommands: []string{"sort"}})
+	p.Executors = map[string]Executor{"sort": ShellExecutor{Path: "/bin/sh"}}
+	defer p.Close()
+
+	if _, err := p.Run("sort | head -1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(p.Text()); got != "a\n" {
+		t.Errorf("text = %q, want %q", got, "a\n")
+	}
+	want := `cat 'in.txt' | '/bin/sh' -c 'sort | head -1'`
+	if got := p.Shell(); got != want {
+		t.Errorf("Shell() = %q, want %q", got, want)
+	}
+}
+
+func TestShellQuotesSource(t *testing.T) {
+	p := New(Source{Name: "my file's;.txt", Encoding: "SHIFT_JIS"}, &Policy{})
+	want := `cat 'my file'\''s;.txt' | iconv -f 'SHIFT_JIS' -t UTF-8`
+	if got := p.Shell(); got != want {
+		t.Errorf("Shell() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,16 @@
+package pipeline
+
+// Policy decides which commands can be executed
+type Policy struct {
+	EnableCommands []string
+}
+
+// Allowed reports whether command is contained in enabled commands
+func (p *Policy) Allowed(command string) bool {
+	for _, c := range p.EnableCommands {
+		if command == c {
+			return true
+		}
+	}
+	return false
+}
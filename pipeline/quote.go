@@ -0,0 +1,13 @@
+package pipeline
+
+import "strings"
+
+// ShellQuote quotes s with single quotes
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// DoubleQuote quotes s with double quotes, so that single quotes in s can be kept as is
+func DoubleQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s) + `"`
+}
@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sampling modes
+const (
+	// SampleHead takes first N lines
+	SampleHead = "head"
+	// SampleRandom takes N lines at random, keeping their order
+	SampleRandom = "random"
+	// SampleEvery takes every N-th line
+	SampleEvery = "every"
+)
+
+// sampleSeed is seed of random sampling, so that the same sample is taken every time
+const sampleSeed = 1
+
+// Sampling represents how lines of text are sampled
+type Sampling struct {
+	Mode string
+	N    int
+}
+
+// ParseSampling parses sampling such as "head:1000", "random:1000" and "every:10"
+func ParseSampling(s string) (Sampling, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return Sampling{}, fmt.Errorf("invalid sampling %q: use head:N, random:N or every:N", s)
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n < 1 {
+		return Sampling{}, fmt.Errorf("invalid sampling %q: N must be a positive number", s)
+	}
+
+	switch parts[0] {
+	case SampleHead, SampleRandom, SampleEvery:
+		return Sampling{Mode: parts[0], N: n}, nil
+	}
+	return Sampling{}, fmt.Errorf("invalid sampling %q: use head:N, random:N or every:N", s)
+}
+
+func (s Sampling) String() string {
+	switch s.Mode {
+	case SampleHead:
+		return fmt.Sprintf("first %d lines", s.N)
+	case SampleRandom:
+		return fmt.Sprintf("%d random lines", s.N)
+	default:
+		return fmt.Sprintf("every %d lines", s.N)
+	}
+}
+
+// Apply returns sampled lines of text
+func (s Sampling) Apply(text []byte) []byte {
+	var out bytes.Buffer
+	switch s.Mode {
+	case SampleHead:
+		i := 0
+		for n := 0; n < s.N && i < len(text); n++ {
+			j := bytes.IndexByte(text[i:], '\n')
+			if j < 0 {
+				i = len(text)
+				break
+			}
+			i += j + 1
+		}
+		out.Write(text[:i])
+	case SampleEvery:
+		eachLine(text, func(n int, line []byte) {
+			if n%s.N == 0 {
+				out.Write(line)
+			}
+		})
+	case SampleRandom:
+		// Reservoir sampling, and lines are sorted back into their order
+		type sampled struct {
+			n    int
+			line []byte
+		}
+		r := rand.New(rand.NewSource(sampleSeed))
+		var reservoir []sampled
+		eachLine(text, func(n int, line []byte) {
+			if n < s.N {
+				reservoir = append(reservoir, sampled{n, line})
+				return
+			}
+			if k := r.Intn(n + 1); k < s.N {
+				reservoir[k] = sampled{n, line}
+			}
+		})
+		sort.Slice(reservoir, func(i, j int) bool { return reservoir[i].n < reservoir[j].n })
+		for _, l := range reservoir {
+			out.Write(l.line)
+		}
+	}
+	return out.Bytes()
+}
+
+// eachLine calls f with number and content of each line including newline
+func eachLine(text []byte, f func(n int, line []byte)) {
+	for n := 0; len(text) > 0; n++ {
+		j := bytes.IndexByte(text, '\n')
+		if j < 0 {
+			f(n, text)
+			return
+		}
+		f(n, text[:j+1])
+		text = text[j+1:]
+	}
+}
+
+// Rerun returns pipeline which has the same stages, run in the same environment, and executors as p, run on source.
+// progress is called before each stage is run.
+func (p *Pipeline) Rerun(source Source, progress func(n int, command string)) (*Pipeline, error) {
+	q := New(source, p.Policy)
+	q.Executor, q.Executors, q.AcceptCodes = p.Executor, p.Executors, p.AcceptCodes
+
+	for n, s := range p.stages {
+		if progress != nil {
+			progress(n, s.Command)
+		}
+		q.Env = s.Env
+		if _, err := q.Run(s.Command); err != nil {
+			q.release(q.stages)
+			return nil, fmt.Errorf("stage %d (%s) failed: %s", n+1, s.Command, err.Error())
+		}
+	}
+	q.Env = p.Env
+	return q, nil
+}
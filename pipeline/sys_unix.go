@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mapFile maps whole file into memory read-only
+func mapFile(f *os.File) ([]byte, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return nil, nil
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("file is too large to map")
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_PRIVATE)
+}
+
+// chrootAttr returns attributes of process changing root directory
+func chrootAttr(root string) (*syscall.SysProcAttr, error) {
+	return &syscall.SysProcAttr{Chroot: root}, nil
+}
+
+// unmapFile releases memory mapped by mapFile
+func unmapFile(b []byte) error {
+	if len(b) < 1 {
+		return nil
+	}
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,26 @@
+package pipeline
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// mapFile reads whole file, since memory mapping is not supported
+func mapFile(f *os.File) ([]byte, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(f)
+}
+
+// chrootAttr returns error, since chroot is not supported
+func chrootAttr(root string) (*syscall.SysProcAttr, error) {
+	return nil, errors.New("chroot is not supported on windows")
+}
+
+// unmapFile does nothing
+func unmapFile(b []byte) error {
+	return nil
+}
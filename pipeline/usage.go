@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// UsageTimeout limits time to get usage of command
+const UsageTimeout = 3 * time.Second
+
+// Usage returns function getting output of "--help" of command, or its manual page when "--help" fails.
+// Commands are run by their executors in environment of pipeline, without input.
+// Only commands allowed by policy are run, and the manual page requires "man" to be allowed.
+// The function only uses state of pipeline at the time of the call of Usage, so that it can be called in background.
+func (p *Pipeline) Usage(name string) func() ([]byte, error) {
+	if strings.HasPrefix(name, BuiltinPrefix) {
+		return func() ([]byte, error) {
+			return nil, fmt.Errorf("%s is a built-in stage, which has no --help", name)
+		}
+	}
+	if !p.Policy.Allowed(name) {
+		return func() ([]byte, error) {
+			return nil, fmt.Errorf("%s cannot be executed", name)
+		}
+	}
+
+	c := Command{Line: ShellQuote(name) + " --help", Args: []string{name, "--help"}, Env: p.Env.Copy()}
+	help := p.executor(c)
+
+	// Manual page is formatted for plain text without pager
+	var man Executor
+	m := Command{Line: "man " + ShellQuote(name), Args: []string{"man", name}, Env: p.Env.Copy()}
+	if p.Policy.Allowed("man") {
+		man = p.executor(m)
+		if m.Env.Set == nil {
+			m.Env.Set = make(map[string]string)
+		}
+		m.Env.Set["MANPAGER"], m.Env.Set["PAGER"] = "cat", "cat"
+	}
+
+	return func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), UsageTimeout)
+		defer cancel()
+
+		var out bytes.Buffer
+		_, helpErr := help.Execute(ctx, c, &bytes.Buffer{}, &out)
+		if helpErr == nil && out.Len() > 0 {
+			return out.Bytes(), nil
+		}
+
+		if man != nil {
+			var page bytes.Buffer
+			if _, err := man.Execute(ctx, m, &bytes.Buffer{}, &page); err == nil && page.Len() > 0 {
+				return stripOverstrike(page.Bytes()), nil
+			}
+		}
+
+		// Commands without --help often print their synopsis to stderr
+		if e, ok := helpErr.(*ExitError); ok && e.Stderr != "" {
+			return []byte(e.Stderr), nil
+		}
+		if out.Len() > 0 {
+			return out.Bytes(), nil
+		}
+		if helpErr == nil {
+			return nil, fmt.Errorf("no help found for %s", name)
+		}
+		return nil, fmt.Errorf("no help found for %s: %s", name, helpErr.Error())
+	}
+}
+
+// stripOverstrike removes bold and underline of manual page made by backspace, such as "N\bN" and "_\bN"
+func stripOverstrike(text []byte) []byte {
+	var b bytes.Buffer
+	for _, c := range text {
+		if c == '\b' {
+			_, size := utf8.DecodeLastRune(b.Bytes())
+			b.Truncate(b.Len() - size)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,69 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeExecutor writes output, or fails with stderr, and records command lines executed
+type fakeExecutor struct {
+	output string
+	stderr string
+	lines  *[]string
+}
+
+func (e fakeExecutor) Execute(ctx context.Context, c Command, stdin io.Reader, stdout io.Writer) (Status, error) {
+	*e.lines = append(*e.lines, c.Line)
+	if e.stderr != "" {
+		return Status{Code: 1}, &ExitError{Status: Status{Code: 1}, Stderr: e.stderr}
+	}
+	_, err := io.WriteString(stdout, e.output)
+	return Status{}, err
+}
+
+func (e fakeExecutor) Shell(c Command) string { return c.Line }
+
+func TestUsage(t *testing.T) {
+	cases := []struct {
+		name    string
+		enable  []string
+		command string
+		want    string
+		wantErr string
+		lines   []string
+	}{
+		{"help", []string{"tool", "man"}, "tool", "tool help", "", []string{"'tool' --help"}},
+		{"manual page", []string{"quiet", "man"}, "quiet", "QUIET(1)", "", []string{"'quiet' --help", "man 'quiet'"}},
+		{"man not enabled", []string{"quiet"}, "quiet", "usage: quiet", "", []string{"'quiet' --help"}},
+		{"not enabled", []string{"man"}, "tool", "", "tool cannot be executed", nil},
+		{"built-in", []string{"man"}, ":path", "", ":path is a built-in stage, which has no --help", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var lines []string
+			p := New(Source{}, &Policy{EnableCommands: c.enable})
+			p.Executors = map[string]Executor{
+				"tool":  fakeExecutor{output: "tool help", lines: &lines},
+				"quiet": fakeExecutor{stderr: "usage: quiet", lines: &lines},
+				"man":   fakeExecutor{output: "Q\bQU\bUIET(1)", lines: &lines},
+			}
+
+			got, err := p.Usage(c.command)()
+			if c.wantErr != "" {
+				if err == nil || err.Error() != c.wantErr {
+					t.Fatalf("error = %v, want %q", err, c.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.want {
+				t.Errorf("usage = %q, want %q", got, c.want)
+			}
+			if strings.Join(lines, "\n") != strings.Join(c.lines, "\n") {
+				t.Errorf("executed %q, want %q", lines, c.lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// Regex flavours of regex workbench
+const (
+	FlavourERE = iota
+	FlavourBRE
+	FlavourRE2
+)
+
+var flavourNames = []string{"POSIX ERE", "POSIX BRE", "Go RE2"}
+
+// ColMatch is background color of regex match
+const ColMatch = termbox.ColorYellow
+
+// RegexBench represent regex workbench overlay
+type RegexBench struct {
+	flavour int
+	// line is line number under cursor
+	line int
+	re   *regexp.Regexp
+	err  error
+	// ereErr is set when pattern cannot be converted into ERE for stage
+	ereErr error
+	saved  InputArea
+	// lines are lines of text, which is not changed while workbench is open
+	lines [][]byte
+}
+
+// ToggleRegexBench opens or closes regex workbench.
+// While it is open, input area is used for pattern.
+func (v *MainView) ToggleRegexBench() {
+	if v.regexBench != nil {
+		v.inputArea = v.regexBench.saved
+		v.regexBench = nil
+		return
+	}
+
+	v.regexBench = &RegexBench{saved: v.inputArea, lines: bytes.Split(v.textArea.text, []byte("\n"))}
+	prompt := []byte("regex> ")
+	v.inputArea = InputArea{
+		cursorInitialPos: len(prompt),
+		prompt:           prompt,
+		history:          v.inputArea.history,
+		historyPos:       len(v.inputArea.history),
+	}
+	v.InitCursor()
+}
+
+// regexBenchPassKeys are keys handled by main loop while regex workbench is open, which edit pattern, scroll or quit.
+// Other keys are consumed, so that pipeline and history are not changed while workbench is open.
+var regexBenchPassKeys = []termbox.Key{
+	termbox.KeyCtrlC, termbox.KeyEsc, termbox.KeyPgup, termbox.KeyPgdn,
+	termbox.KeyArrowLeft, termbox.KeyArrowRight, termbox.KeyCtrlA, termbox.KeyCtrlE, termbox.KeyCtrlB, termbox.KeyCtrlF,
+	termbox.KeyBackspace, termbox.KeyBackspace2, termbox.KeyDelete, termbox.KeyCtrlD, termbox.KeySpace,
+}
+
+// HandleRegexBenchKey handles key for regex workbench, and reports whether key is consumed
+func (v *MainView) HandleRegexBenchKey(ev termbox.Event) bool {
+	b := v.regexBench
+	switch ev.Key {
+	case termbox.KeyF10:
+		v.ToggleRegexBench()
+	case termbox.KeyTab:
+		b.flavour = (b.flavour + 1) % len(flavourNames)
+	case termbox.KeyF5:
+		if b.line > 0 {
+			b.line--
+		}
+	case termbox.KeyF6:
+		if b.line < len(b.lines)-1 {
+			b.line++
+		}
+	case termbox.KeyF7, termbox.KeyF8, termbox.KeyF9, termbox.KeyEnter:
+		ere, err := toERE(string(v.inputArea.text), b.flavour)
+		if err != nil {
+			return true
+		}
+
+		var stage string
+		var cursor int
+		switch ev.Key {
+		case termbox.KeyF7, termbox.KeyEnter:
+			stage = "grep -E " + pipeline.ShellQuote(ere)
+			cursor = len(stage)
+		case termbox.KeyF8:
+			stage = "sed -E " + pipeline.ShellQuote("s/"+escapeDelimiter(ere, '/')+"//")
+			cursor = len(stage) - 2
+		case termbox.KeyF9:
+			stage = "awk " + pipeline.ShellQuote("/"+escapeDelimiter(ere, '/')+"/ { print }")
+			cursor = len(stage) - len(" print }'")
+		}
+		v.ToggleRegexBench()
+		v.inputArea.text = []byte(stage)
+		v.inputArea.cursorByteOffset = cursor
+		v.inputArea.cursorPos = v.inputArea.cursorInitialPos + runewidth.StringWidth(stage[:cursor])
+	default:
+		if ev.Ch != 0 {
+			return false
+		}
+		for _, k := range regexBenchPassKeys {
+			if ev.Key == k {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compile compiles pattern in input area with flavour of workbench
+func (b *RegexBench) compile(pattern string) {
+	b.re, b.err, b.ereErr = nil, nil, nil
+	if pattern == "" {
+		return
+	}
+
+	if b.flavour == FlavourRE2 {
+		if b.re, b.err = regexp.Compile(pattern); b.err == nil {
+			_, b.ereErr = re2ToERE(pattern)
+		}
+		return
+	}
+
+	ere, err := toERE(pattern, b.flavour)
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.re, b.err = regexp.CompilePOSIX(ere)
+}
+
+// drawRegexBench updates back buffer for text area with matches highlighted, and info line
+// which shows flavour, match count and capture groups of the line under cursor
+func (v *MainView) drawRegexBench() {
+	b := v.regexBench
+	b.compile(string(v.inputArea.text))
+
+	top, height := TextAreaPos, v.height-TextAreaPos
+	if b.line < v.textArea.offset {
+		v.textArea.offset = b.line
+	}
+	if b.line >= v.textArea.offset+height {
+		v.textArea.offset = b.line - height + 1
+	}
+
+	var matches, matchedLines int
+	var groups []string
+	for n, line := range b.lines {
+		var locs [][]int
+		if b.re != nil {
+			locs = b.re.FindAllSubmatchIndex(line, -1)
+		}
+		matches += len(locs)
+		if len(locs) > 0 {
+			matchedLines++
+		}
+		if n == b.line && len(locs) > 0 {
+			loc := locs[0]
+			for g := 1; g*2 < len(loc); g++ {
+				if loc[g*2] < 0 {
+					groups = append(groups, fmt.Sprintf("\\%d=(unset)", g))
+					continue
+				}
+				groups = append(groups, fmt.Sprintf("\\%d=%q", g, line[loc[g*2]:loc[g*2+1]]))
+			}
+		}
+
+		y := top + n - v.textArea.offset
+		if y < top || y >= top+height {
+			continue
+		}
+		var x int
+		for i, c := range string(line) {
+			fg, bg := ColFg, ColBg
+			for _, loc := range locs {
+				if i >= loc[0] && i < loc[1] {
+					fg, bg = termbox.ColorBlack, ColMatch
+				}
+			}
+			if n == b.line {
+				fg |= termbox.AttrUnderline
+			}
+			if x+runewidth.RuneWidth(c) > v.width {
+				break
+			}
+			v.screen.SetCell(x, y, c, fg, bg)
+			x += runewidth.RuneWidth(c)
+		}
+	}
+
+	var info string
+	switch {
+	case b.err != nil:
+		info = fmt.Sprintf("[%s] %s", flavourNames[b.flavour], b.err.Error())
+	case b.ereErr != nil:
+		info = fmt.Sprintf("[%s] %d matches in %d lines | no stage: %s",
+			flavourNames[b.flavour], matches, matchedLines, b.ereErr.Error())
+	default:
+		info = fmt.Sprintf("[%s] %d matches in %d lines | line %d: %s",
+			flavourNames[b.flavour], matches, matchedLines, b.line+1, strings.Join(groups, " "))
+	}
+	var x int
+	for _, c := range info {
+		v.screen.SetCell(x, InputErrorPos, c, ColFg, ColBg)
+		x += runewidth.RuneWidth(c)
+	}
+}
+
+// bracketEnd returns index of ']' closing bracket expression starting at i
+func bracketEnd(p string, i int) int {
+	j := i + 1
+	if j < len(p) && p[j] == '^' {
+		j++
+	}
+	if j < len(p) && p[j] == ']' {
+		j++
+	}
+	for ; j < len(p); j++ {
+		switch {
+		case p[j] == '[' && j+1 < len(p) && strings.IndexByte(":.=", p[j+1]) >= 0:
+			end := strings.Index(p[j+2:], string(p[j+1])+"]")
+			if end < 0 {
+				return -1
+			}
+			j += 2 + end + 1
+		case p[j] == ']':
+			return j
+		}
+	}
+	return -1
+}
+
+// toERE converts pattern of flavour into POSIX ERE
+func toERE(p string, flavour int) (string, error) {
+	switch flavour {
+	case FlavourBRE:
+		return breToERE(p)
+	case FlavourRE2:
+		if _, err := regexp.Compile(p); err != nil {
+			return "", err
+		}
+		return re2ToERE(p)
+	}
+	return p, nil
+}
+
+func breToERE(p string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '[':
+			end := bracketEnd(p, i)
+			if end < 0 {
+				return "", errors.New("unmatched [")
+			}
+			b.WriteString(p[i : end+1])
+			i = end
+		case c == '\\' && i+1 < len(p):
+			i++
+			if strings.IndexByte("(){}|+?", p[i]) >= 0 {
+				b.WriteByte(p[i])
+			} else {
+				b.WriteByte('\\')
+				b.WriteByte(p[i])
+			}
+		case strings.IndexByte("(){}|+?", c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '*' && (i == 0 || b.String() == "^" || strings.HasSuffix(b.String(), "(") && !strings.HasSuffix(b.String(), `\(`)):
+			// Leading "*" is literal in BRE
+			b.WriteString(`\*`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// re2Classes are Perl character classes of RE2 and their POSIX equivalents outside and inside bracket
+var re2Classes = map[byte][2]string{
+	'd': {"[0-9]", "0-9"},
+	'D': {"[^0-9]", ""},
+	'w': {"[[:alnum:]_]", "[:alnum:]_"},
+	'W': {"[^[:alnum:]_]", ""},
+	's': {"[[:space:]]", "[:space:]"},
+	'S': {"[^[:space:]]", ""},
+}
+
+func re2ToERE(p string) (string, error) {
+	for _, unsupported := range []string{"(?", "*?", "+?", "??", "}?", `\b`, `\B`, `\A`, `\z`, `\p`, `\P`, `\Q`} {
+		if strings.Contains(p, unsupported) {
+			return "", fmt.Errorf("%s cannot be expressed in POSIX ERE", unsupported)
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '[':
+			end := bracketEnd(p, i)
+			if end < 0 {
+				return "", errors.New("unmatched [")
+			}
+			for j := i; j <= end; j++ {
+				if p[j] == '\\' && j+1 < end {
+					// Backslash is literal in bracket of POSIX ERE
+					if !isAlnum(p[j+1]) {
+						b.WriteByte(p[j+1])
+						j++
+						continue
+					}
+					class, ok := re2Classes[p[j+1]]
+					if !ok || class[1] == "" {
+						return "", fmt.Errorf(`\%c in bracket cannot be expressed in POSIX ERE`, p[j+1])
+					}
+					b.WriteString(class[1])
+					j++
+					continue
+				}
+				b.WriteByte(p[j])
+			}
+			i = end
+		case c == '\\' && i+1 < len(p):
+			i++
+			if class, ok := re2Classes[p[i]]; ok {
+				b.WriteString(class[0])
+				continue
+			}
+			b.WriteByte('\\')
+			b.WriteByte(p[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// escapeDelimiter escapes delim outside bracket expressions
+func escapeDelimiter(p string, delim byte) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case c == '[':
+			if end := bracketEnd(p, i); end >= 0 {
+				b.WriteString(p[i : end+1])
+				i = end
+				continue
+			}
+			b.WriteByte(c)
+		case c == '\\' && i+1 < len(p):
+			b.WriteString(p[i : i+2])
+			i++
+		case c == delim:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
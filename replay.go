@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// Replay applies stages to source of pipeline without interactive mode and writes the result to w
+func Replay(w io.Writer, p *pipeline.Pipeline, stages []string, expectedHash string) error {
+	for n, stage := range stages {
+		warn, err := p.Run(stage)
+		if err != nil {
+			return fmt.Errorf("stage %d (%s) failed: %s", n+1, stage, err.Error())
+		}
+		if warn != "" {
+			fmt.Fprintf(os.Stderr, "stage %d (%s): %s\n", n+1, stage, strings.TrimRight(warn, "\n"))
+		}
+	}
+
+	text := p.Text()
+	if expectedHash != "" {
+		if h := HashText(text); h != expectedHash {
+			return fmt.Errorf("output hash mismatch: expected %s, got %s", expectedHash, h)
+		}
+	}
+
+	_, err := w.Write(text)
+	return err
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// ApplyToFull re-runs stages of current buffer on full input instead of sample, showing progress
+func (v *MainView) ApplyToFull() error {
+	b := &v.buffers[v.current]
+	if b.full == nil {
+		return errors.New("text is not a sample")
+	}
+
+	total := b.pipeline.Len()
+	p, err := b.pipeline.Rerun(*b.full, func(n int, command string) {
+		v.InputError(fmt.Sprintf("applying to full input: stage %d/%d: %s", n+1, total, command))
+		v.Flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	b.pipeline.Close()
+	b.pipeline, b.full, b.sampling = p, nil, ""
+	v.syncText()
+	return nil
+}
+
+// sampleSource returns source of sampled lines of full source
+func sampleSource(full pipeline.Source, s pipeline.Sampling) pipeline.Source {
+	return pipeline.Source{Name: full.Name, Text: s.Apply(full.Text), Encoding: full.Encoding}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// Screen is drawing target of views
+type Screen interface {
+	Clear(fg, bg termbox.Attribute) error
+	SetCell(x, y int, ch rune, fg, bg termbox.Attribute)
+	SetCursor(x, y int)
+	Size() (int, int)
+	Flush() error
+}
+
+// EventSource provides input events for main loop
+type EventSource interface {
+	PollEvent() termbox.Event
+}
+
+// Interrupter is EventSource whose waiting for event can be interrupted from another goroutine
+type Interrupter interface {
+	// Interrupt makes PollEvent return event of termbox.EventInterrupt
+	Interrupt()
+}
+
+// TermboxScreen is Screen backed by terminal through termbox
+type TermboxScreen struct{}
+
+// NewTermboxScreen initializes termbox and returns screen of it
+func NewTermboxScreen() (*TermboxScreen, error) {
+	if err := termbox.Init(); err != nil {
+		return nil, err
+	}
+	termbox.SetInputMode(termbox.InputEsc)
+	return &TermboxScreen{}, nil
+}
+
+// Clear clears back buffer
+func (TermboxScreen) Clear(fg, bg termbox.Attribute) error { return termbox.Clear(fg, bg) }
+
+// SetCell sets cell of back buffer
+func (TermboxScreen) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	termbox.SetCell(x, y, ch, fg, bg)
+}
+
+// SetCursor sets cursor position
+func (TermboxScreen) SetCursor(x, y int) { termbox.SetCursor(x, y) }
+
+// Size returns size of terminal
+func (TermboxScreen) Size() (int, int) { return termbox.Size() }
+
+// Flush synchronizes terminal with back buffer
+func (TermboxScreen) Flush() error { return termbox.Flush() }
+
+// Close finalizes termbox
+func (TermboxScreen) Close() { termbox.Close() }
+
+// PollEvent waits for terminal event
+func (TermboxScreen) PollEvent() termbox.Event { return termbox.PollEvent() }
+
+// Interrupt interrupts waiting for terminal event
+func (TermboxScreen) Interrupt() { termbox.Interrupt() }
+
+// SetClipboard sets text to clipboard of terminal
+func (TermboxScreen) SetClipboard(text []byte) error { return CopyToClipboard(text) }
+
+// MemoryScreen is Screen kept in memory, for driving views without terminal
+type MemoryScreen struct {
+	width   int
+	height  int
+	back    []termbox.Cell
+	front   []termbox.Cell
+	cursorX int
+	cursorY int
+	// clipboard is text set by SetClipboard
+	clipboard []byte
+}
+
+// NewMemoryScreen returns blank screen of the size
+func NewMemoryScreen(width, height int) *MemoryScreen {
+	s := &MemoryScreen{
+		width:  width,
+		height: height,
+		back:   make([]termbox.Cell, width*height),
+		front:  make([]termbox.Cell, width*height),
+	}
+	s.Clear(ColBg, ColBg)
+	s.Flush()
+	return s
+}
+
+// Clear clears back buffer
+func (s *MemoryScreen) Clear(fg, bg termbox.Attribute) error {
+	for n := range s.back {
+		s.back[n] = termbox.Cell{Ch: ' ', Fg: fg, Bg: bg}
+	}
+	return nil
+}
+
+// SetCell sets cell of back buffer. Cells out of screen are ignored.
+func (s *MemoryScreen) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	if x < 0 || x >= s.width || y < 0 || y >= s.height {
+		return
+	}
+	s.back[y*s.width+x] = termbox.Cell{Ch: ch, Fg: fg, Bg: bg}
+}
+
+// SetCursor sets cursor position
+func (s *MemoryScreen) SetCursor(x, y int) {
+	s.cursorX, s.cursorY = x, y
+}
+
+// Size returns size of screen
+func (s *MemoryScreen) Size() (int, int) {
+	return s.width, s.height
+}
+
+// Flush copies back buffer to front buffer
+func (s *MemoryScreen) Flush() error {
+	copy(s.front, s.back)
+	return nil
+}
+
+// SetClipboard keeps text as clipboard of screen
+func (s *MemoryScreen) SetClipboard(text []byte) error {
+	s.clipboard = append([]byte{}, text...)
+	return nil
+}
+
+// Clipboard returns text set by SetClipboard
+func (s *MemoryScreen) Clipboard() []byte {
+	return s.clipboard
+}
+
+// Cell returns flushed cell at the position
+func (s *MemoryScreen) Cell(x, y int) termbox.Cell {
+	return s.front[y*s.width+x]
+}
+
+// Cursor returns cursor position
+func (s *MemoryScreen) Cursor() (int, int) {
+	return s.cursorX, s.cursorY
+}
+
+// String returns flushed contents as text, one line per row without trailing spaces
+func (s *MemoryScreen) String() string {
+	var b strings.Builder
+	for y := 0; y < s.height; y++ {
+		var line strings.Builder
+		for x := 0; x < s.width; x++ {
+			c := s.front[y*s.width+x].Ch
+			line.WriteRune(c)
+			// Wide character occupies the next cell
+			if runewidth.RuneWidth(c) > 1 {
+				x++
+			}
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// ScriptedEvents is EventSource which returns events in order.
+// After all events are returned, it returns Esc key so that main loop quits.
+type ScriptedEvents struct {
+	events []termbox.Event
+}
+
+// NewScriptedEvents returns EventSource of events
+func NewScriptedEvents(events ...termbox.Event) *ScriptedEvents {
+	return &ScriptedEvents{events: events}
+}
+
+// PollEvent returns next event
+func (s *ScriptedEvents) PollEvent() termbox.Event {
+	if len(s.events) < 1 {
+		return KeyEvent(termbox.KeyEsc)
+	}
+	ev := s.events[0]
+	s.events = s.events[1:]
+	return ev
+}
+
+// KeyEvent returns event of special key
+func KeyEvent(k termbox.Key) termbox.Event {
+	return termbox.Event{Type: termbox.EventKey, Key: k}
+}
+
+// TypeEvents returns events of typing text
+func TypeEvents(text string) []termbox.Event {
+	var events []termbox.Event
+	for _, c := range text {
+		if c == ' ' {
+			events = append(events, KeyEvent(termbox.KeySpace))
+			continue
+		}
+		events = append(events, termbox.Event{Type: termbox.EventKey, Ch: c})
+	}
+	return events
+}
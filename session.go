@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// DefaultSessionPath is session file path used when no path is specified
+const DefaultSessionPath = "txtmanip-session.toml"
+
+// Session represents recorded buffers and state of input area
+type Session struct {
+	Buffers []SessionBuffer `toml:"buffers"`
+	// Current is index of current buffer in Buffers
+	Current int        `toml:"current"`
+	History []string   `toml:"history,omitempty"`
+	Input   InputState `toml:"input"`
+}
+
+// SessionBuffer represents recorded pipeline of buffer
+type SessionBuffer struct {
+	Source       string `toml:"source"`
+	SourceSHA256 string `toml:"source_sha256,omitempty"`
+	SourceText   string `toml:"source_text,omitempty"`
+	// SourceEncoding is encoding which SourceText has been converted from
+	SourceEncoding string `toml:"source_encoding,omitempty"`
+	// Environment is environment of commands in the form of env arguments, such as "-u LANG LC_ALL=C"
+	Environment string   `toml:"environment,omitempty"`
+	Stages      []string `toml:"stages"`
+	// Redo are stages reverted by undo, in order of redo
+	Redo         []string          `toml:"redo,omitempty"`
+	Bookmarks    []SessionBookmark `toml:"bookmarks,omitempty"`
+	Snapshots    []string          `toml:"snapshots,omitempty"`
+	OutputSHA256 string            `toml:"output_sha256"`
+}
+
+// sessionFile represents session file, which has fields of SessionBuffer at top level instead of buffers
+// when it has been saved with single buffer by earlier version
+type sessionFile struct {
+	Session
+	SessionBuffer
+}
+
+// SessionBookmark represents bookmark of stage, counted through stages and redo
+type SessionBookmark struct {
+	Name  string `toml:"name"`
+	Stage int    `toml:"stage"`
+}
+
+// InputState represents state of input area
+type InputState struct {
+	Text             string `toml:"text"`
+	CursorPos        int    `toml:"cursor_pos"`
+	CursorByteOffset int    `toml:"cursor_byte_offset"`
+	HistoryPos       int    `toml:"history_pos"`
+}
+
+// NewSession returns session holding current state of every buffer and input area in view
+func NewSession(v *MainView) *Session {
+	s := &Session{
+		Current: v.current,
+		History: append([]string{}, v.inputArea.history...),
+		Input: InputState{
+			Text:             string(v.inputArea.text),
+			CursorPos:        v.inputArea.cursorPos,
+			CursorByteOffset: v.inputArea.cursorByteOffset,
+			HistoryPos:       v.inputArea.historyPos,
+		},
+	}
+	for n := range v.buffers {
+		s.Buffers = append(s.Buffers, newSessionBuffer(&v.buffers[n]))
+	}
+	return s
+}
+
+// newSessionBuffer returns recorded pipeline of buffer.
+// Text read from standard input is stored in session since it cannot be read again.
+// Hashes of output are not recorded when stages run on sample.
+func newSessionBuffer(b *Buffer) SessionBuffer {
+	p, source := b.pipeline, b.Source()
+	s := SessionBuffer{
+		Source:       source.Name,
+		SourceSHA256: HashText(source.Text),
+		Environment:  p.Env.String(),
+		Stages:       p.Commands(),
+		Redo:         p.UndoneCommands(),
+	}
+	for _, bm := range b.bookmarks {
+		s.Bookmarks = append(s.Bookmarks, SessionBookmark{Name: bm.Name, Stage: bm.Stage})
+	}
+	if source.Name == "" {
+		s.SourceText = string(source.Text)
+		s.SourceEncoding = source.Encoding
+	}
+	if b.full != nil {
+		return s
+	}
+	s.OutputSHA256 = HashText(p.Text())
+	for n := 0; n < p.Len(); n++ {
+		s.Snapshots = append(s.Snapshots, HashText(p.Snapshot(n)))
+	}
+	return s
+}
+
+// Buffer returns recorded pipeline of buffer n, or nil when session has no such buffer
+func (s *Session) Buffer(n int) *SessionBuffer {
+	if n < 0 || n >= len(s.Buffers) {
+		return nil
+	}
+	return &s.Buffers[n]
+}
+
+// Restore re-applies stages of session to buffers in view in order, and restores state of input area.
+// warnings describe differences from the time of saving, and stages which cannot be restored.
+func (s *Session) Restore(v *MainView) (warnings []string) {
+	if len(s.Buffers) != len(v.buffers) {
+		warnings = append(warnings, fmt.Sprintf("session has %d buffers, while %d are open", len(s.Buffers), len(v.buffers)))
+	}
+	for n := range v.buffers {
+		if n >= len(s.Buffers) {
+			break
+		}
+		v.loadBuffer(n)
+		for _, w := range s.Buffers[n].restore(v) {
+			// Buffer is named only when there are several buffers
+			if len(v.buffers) > 1 {
+				w = fmt.Sprintf("%s: %s", v.buffers[n].DisplayName(), w)
+			}
+			warnings = append(warnings, w)
+		}
+		v.storeBuffer()
+	}
+	if s.Current >= 0 && s.Current < len(v.buffers) {
+		v.loadBuffer(s.Current)
+	} else {
+		v.loadBuffer(0)
+	}
+
+	v.inputArea.history = append([]string{}, s.History...)
+	v.inputArea.historyPos = s.Input.HistoryPos
+	if v.inputArea.historyPos > len(v.inputArea.history) {
+		v.inputArea.historyPos = len(v.inputArea.history)
+	}
+	v.inputArea.text = []byte(s.Input.Text)
+	v.InitCursor()
+	if s.Input.CursorByteOffset <= len(v.inputArea.text) {
+		v.inputArea.cursorPos = s.Input.CursorPos
+		v.inputArea.cursorByteOffset = s.Input.CursorByteOffset
+	}
+	return warnings
+}
+
+// restore re-applies stages to current buffer in view, and returns warnings
+func (s *SessionBuffer) restore(v *MainView) (warnings []string) {
+	b := &v.buffers[v.current]
+	p := b.pipeline
+	if s.SourceSHA256 != "" && HashText(b.Source().Text) != s.SourceSHA256 {
+		warnings = append(warnings, "source changed since the session was saved")
+	}
+	snapshots, output := s.Snapshots, s.OutputSHA256
+	if b.full != nil {
+		// Hashes of stages only hold for full input
+		snapshots, output = nil, ""
+	}
+	if err := s.apply(p); err != nil {
+		return append(warnings, err.Error())
+	}
+
+	for n, stage := range s.Stages {
+		if n < len(snapshots) && HashText(p.Text()) != snapshots[n] {
+			warnings = append(warnings, fmt.Sprintf("input of stage %d differs from the saved one", n+1))
+		}
+
+		if _, err := p.Run(stage); err != nil {
+			v.syncText()
+			return append(warnings, fmt.Sprintf("stage %d (%s) failed: %s", n+1, stage, err.Error()))
+		}
+	}
+	// Stages reverted by undo are run and reverted again, so that they can be redone and bookmarked
+	for n, stage := range s.Redo {
+		if _, err := p.Run(stage); err != nil {
+			warnings = append(warnings, fmt.Sprintf("stage %d (%s) to redo failed: %s", len(s.Stages)+n+1, stage, err.Error()))
+			break
+		}
+	}
+	p.Seek(len(s.Stages))
+	timeline := b.timeline()
+	for _, bm := range s.Bookmarks {
+		if bm.Stage < 0 || bm.Stage > len(timeline) {
+			warnings = append(warnings, fmt.Sprintf("bookmark %s is out of stages", bm.Name))
+			continue
+		}
+		b.bookmarks = append(b.bookmarks, Bookmark{Name: bm.Name, Stage: bm.Stage, commands: timeline[:bm.Stage]})
+	}
+	v.syncText()
+	if output != "" && HashText(p.Text()) != output {
+		warnings = append(warnings, "output differs from the saved one")
+	}
+	return warnings
+}
+
+// IsSource reports whether source has the same text as the source session was recorded on, so that hashes of session hold.
+// Name of source is compared instead when session has no hash of source.
+func (s *SessionBuffer) IsSource(source pipeline.Source) bool {
+	if s.SourceSHA256 != "" {
+		return HashText(source.Text) == s.SourceSHA256
+	}
+	return source.Name == s.Source
+}
+
+// apply sets environment of session to pipeline, which replaces environment of configuration
+func (s *SessionBuffer) apply(p *pipeline.Pipeline) error {
+	if s.Environment == "" {
+		return nil
+	}
+	env, err := pipeline.ParseEnvironment(pipeline.Environment{}, s.Environment)
+	if err != nil {
+		return fmt.Errorf("environment of session: %s", err.Error())
+	}
+	p.Env = env
+	return nil
+}
+
+// LoadSession reads session file. Session file of single buffer saved by earlier version is read as well.
+func LoadSession(path string) (*Session, error) {
+	var f sessionFile
+	if _, err := toml.DecodeFile(path, &f); err != nil {
+		return nil, err
+	}
+	s := f.Session
+	if len(s.Buffers) < 1 {
+		s.Buffers = []SessionBuffer{f.SessionBuffer}
+	}
+	return &s, nil
+}
+
+// Save writes session to file
+func (s *Session) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := toml.NewEncoder(f).Encode(s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HashText returns hex encoded SHA-256 digest of text
+func HashText(text []byte) string {
+	sum := sha256.Sum256(text)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// Split layouts of text area
+const (
+	SplitNone = iota
+	// SplitHorizontal stacks panes top and bottom
+	SplitHorizontal
+	// SplitVertical places panes side by side
+	SplitVertical
+)
+
+// ToggleSplit switches split layout in order of horizontal, vertical and none
+func (v *MainView) ToggleSplit() {
+	v.split = (v.split + 1) % 3
+}
+
+// NextSplitRef switches stage shown next to current result, wrapping around to source
+func (v *MainView) NextSplitRef() {
+	if v.Pipeline().Len() < 1 {
+		v.splitRef = 0
+		return
+	}
+	v.splitRef = (v.splitRef + 1) % v.Pipeline().Len()
+}
+
+// splitRefText returns text and title of stage shown next to current result.
+// Stage 0 is source, and stage n is the output of n-th invoked command.
+func (v *MainView) splitRefText() ([]byte, string) {
+	p := v.Pipeline()
+	if p.Len() < 1 {
+		return v.textArea.text, "source"
+	}
+	if v.splitRef >= p.Len() {
+		v.splitRef = p.Len() - 1
+	}
+
+	text := p.Snapshot(v.splitRef)
+	if v.splitRef == 0 {
+		return text, "source"
+	}
+	return text, fmt.Sprintf("stage %d: %s", v.splitRef, p.Commands()[v.splitRef-1])
+}
+
+// drawSplit updates back buffer for panes of reference stage and current result.
+// Both panes are scrolled by offset of text area.
+func (v *MainView) drawSplit() {
+	refText, refTitle := v.splitRefText()
+	curTitle := fmt.Sprintf("stage %d (current)", v.Pipeline().Len())
+
+	top := TextAreaPos
+	height := v.height - top
+	switch v.split {
+	case SplitHorizontal:
+		h := height / 2
+		drawPaneTitle(v.screen, refTitle, 0, top, v.width)
+		drawTextBox(v.screen, refText, 0, top+1, v.width, h-1, v.textArea.offset, false)
+		drawPaneTitle(v.screen, curTitle, 0, top+h, v.width)
+		drawTextBox(v.screen, v.textArea.text, 0, top+h+1, v.width, height-h-1, v.textArea.offset, false)
+	case SplitVertical:
+		w := v.width / 2
+		drawPaneTitle(v.screen, refTitle, 0, top, w)
+		drawTextBox(v.screen, refText, 0, top+1, w, height-1, v.textArea.offset, false)
+		for y := top; y < v.height; y++ {
+			v.screen.SetCell(w, y, rune('|'), ColFg, ColBg)
+		}
+		drawPaneTitle(v.screen, curTitle, w+1, top, v.width-w-1)
+		drawTextBox(v.screen, v.textArea.text, w+1, top+1, v.width-w-1, height-1, v.textArea.offset, false)
+	}
+}
+
+func drawPaneTitle(s Screen, title string, x0, y, width int) {
+	var x int
+	for _, c := range title {
+		if x+runewidth.RuneWidth(c) > width {
+			break
+		}
+		s.SetCell(x0+x, y, c, ColFg|termbox.AttrReverse, ColBg)
+		x += runewidth.RuneWidth(c)
+	}
+	for ; x < width; x++ {
+		s.SetCell(x0+x, y, rune(' '), ColFg|termbox.AttrReverse, ColBg)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// DefaultStatusTemplate is template of status bar used when status_template is not configured
+const DefaultStatusTemplate = `{{if gt .Buffers 1}}{{.Tabs}}{{else}}{{.Source}}{{end}}` +
+	` | stage {{.Stage}}/{{.Stages}}` +
+	` | {{.Lines}} lines {{.Words}} words {{.Bytes}} bytes` +
+	` | {{.Top}}-{{.Bottom}}/{{.Total}} {{.Percent}}%` +
+	`{{if .Running}} | running {{.Command}}: {{.Received}} lines in {{.Duration}}` +
+	`{{else if .Command}} | exit {{.Exit}} in {{.Duration}}{{end}}` +
+	`{{if .Modes}} | {{.Modes}}{{end}}`
+
+// StatusInfo represent values available in status bar template
+type StatusInfo struct {
+	// Source is name of input of current buffer
+	Source  string
+	Buffer  int
+	Buffers int
+	// Tabs is tab of each buffer, such as "[*1:a.txt (2)] [2:b.txt (0)]"
+	Tabs string
+	// Stage is number of current stage, and Stages includes stages which can be restored by redo
+	Stage  int
+	Stages int
+	// Lines, Words and Bytes are counts of current text, like wc
+	Lines int
+	Words int
+	Bytes int
+	// Top and Bottom are first and last rows shown in text area, out of Total rows
+	Top     int
+	Bottom  int
+	Total   int
+	Percent int
+	// Command, Exit and Duration are of last command. Command is empty when no command has run.
+	// While command is running, Running is true and Received is number of lines received so far.
+	Running  bool
+	Received int
+	Command  string
+	Exit     string
+	Duration string
+	// Modes are mode indicators, such as sample, wrap and table
+	Modes string
+	// Env is environment of commands in the form of env arguments
+	Env string
+}
+
+// textMetrics represent counts of text like wc
+type textMetrics struct {
+	lines int
+	words int
+	bytes int
+}
+
+// countText counts newlines, words separated by white spaces and bytes of text
+func countText(text []byte) textMetrics {
+	m := textMetrics{lines: bytes.Count(text, []byte("\n")), bytes: len(text)}
+	inWord := false
+	for _, c := range text {
+		space := c == ' ' || c == '\n' || c == '\t' || c == '\r' || c == '\v' || c == '\f'
+		if !space && !inWord {
+			m.words++
+		}
+		inWord = !space
+	}
+	return m
+}
+
+// statusInfo returns values of status bar for current state
+func (v *MainView) statusInfo() StatusInfo {
+	b := &v.buffers[v.current]
+	p := b.pipeline
+	info := StatusInfo{
+		Source:  b.DisplayName(),
+		Buffer:  v.current + 1,
+		Buffers: len(v.buffers),
+		Tabs:    v.tabs(),
+		Stage:   p.Len(),
+		Stages:  p.Len() + p.Undone(),
+		Lines:   v.metrics.lines,
+		Words:   v.metrics.words,
+		Bytes:   v.metrics.bytes,
+		Env:     p.Env.String(),
+	}
+
+	info.Total = v.textArea.index.Len()
+	if bytes.HasSuffix(v.textArea.text, []byte("\n")) {
+		info.Total--
+	}
+	if v.hexView != nil {
+		info.Total = v.hexView.Rows(v.width)
+	}
+	if info.Total > 0 {
+		info.Top = v.textArea.offset + 1
+		info.Bottom = v.textArea.offset + v.height - TextAreaPos
+		if info.Bottom > info.Total {
+			info.Bottom = info.Total
+		}
+		info.Percent = info.Bottom * 100 / info.Total
+	}
+
+	if r := p.Last(); r != nil {
+		info.Command = r.Command
+		info.Exit = fmt.Sprint(r.Code)
+		switch {
+		case r.Err == context.Canceled:
+			info.Exit = "canceled"
+		case r.Signal != "":
+			info.Exit = fmt.Sprintf("signal (%s)", r.Signal)
+		case r.Code < 0:
+			info.Exit = "error"
+		}
+		info.Duration = r.Duration.Round(time.Millisecond).String()
+	}
+	if r := v.running; r != nil {
+		_, info.Received = r.output.received()
+		info.Running = true
+		info.Command = r.line
+		info.Exit = ""
+		info.Duration = time.Since(r.start).Round(100 * time.Millisecond).String()
+	}
+
+	var modes []string
+	if b.full != nil {
+		modes = append(modes, "sample: "+b.sampling)
+	}
+	if p.Spool {
+		modes = append(modes, "large")
+	}
+	if !p.Env.Empty() {
+		modes = append(modes, "env")
+	}
+	if v.filter {
+		modes = append(modes, "filter")
+	}
+	switch {
+	case v.hexView != nil:
+		modes = append(modes, "hex")
+	case v.jsonView != nil:
+		modes = append(modes, "json")
+	case v.table != nil:
+		modes = append(modes, "table")
+	}
+	if v.split != SplitNone {
+		modes = append(modes, "split")
+	}
+	if v.wrap {
+		modes = append(modes, "wrap")
+	}
+	if v.regexBench != nil {
+		modes = append(modes, "regex")
+	}
+	if v.recording != nil {
+		modes = append(modes, "recording "+v.recording.name)
+	}
+	if v.commandHelp != nil {
+		modes = append(modes, "command help")
+	}
+	info.Modes = strings.Join(modes, ", ")
+	return info
+}
+
+// DrawStatusBar updates back buffer for status bar between input area and text area
+func (v *MainView) DrawStatusBar() {
+	var b bytes.Buffer
+	if err := v.statusTemplate.Execute(&b, v.statusInfo()); err != nil {
+		b.Reset()
+		b.WriteString(fmt.Sprint("status template error: ", err.Error()))
+	}
+
+	var x int
+	for _, c := range b.String() {
+		if x+runewidth.RuneWidth(c) > v.width {
+			break
+		}
+		v.screen.SetCell(x, StatusBarPos, c, ColFg|termbox.AttrReverse, ColBg)
+		x += runewidth.RuneWidth(c)
+	}
+	for ; x < v.width; x++ {
+		v.screen.SetCell(x, StatusBarPos, rune(' '), ColFg|termbox.AttrReverse, ColBg)
+	}
+}
+
+// ToggleWrap switches between wrapping and cutting off long lines in text area
+func (v *MainView) ToggleWrap() {
+	v.wrap = !v.wrap
+}
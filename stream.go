@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+const (
+	// streamPreviewSize is max bytes of output kept for showing while command is running
+	streamPreviewSize = 1 << 20
+	// streamInterval is interval of redrawing output of running command
+	streamInterval = 100 * time.Millisecond
+)
+
+// streamOutput receives output of running command as it arrives
+type streamOutput struct {
+	mu    sync.Mutex
+	text  []byte
+	lines int
+}
+
+func (o *streamOutput) Write(b []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if n := streamPreviewSize - len(o.text); n > 0 {
+		if n > len(b) {
+			n = len(b)
+		}
+		o.text = append(o.text, b[:n]...)
+	}
+	o.lines += bytes.Count(b, []byte("\n"))
+	return len(b), nil
+}
+
+// received returns output received so far and its number of lines
+func (o *streamOutput) received() ([]byte, int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.text, o.lines
+}
+
+// runningCommand represent command running in background, whose output is streamed into text area
+type runningCommand struct {
+	line   string
+	job    *pipeline.Job
+	output *streamOutput
+	start  time.Time
+	// converted is output converted into UTF-8 for display up to convertedEnd bytes
+	converted    []byte
+	convertedEnd int
+	// unconverted is true when output cannot be converted, so that it is shown as is
+	unconverted bool
+}
+
+// display returns output received so far for display.
+// Output in encoding is converted by complete lines, so that each line is converted only once.
+func (r *runningCommand) display(text []byte, encoding string) []byte {
+	if encoding == "" || r.unconverted {
+		return text
+	}
+	if end := bytes.LastIndexByte(text, '\n') + 1; end > r.convertedEnd {
+		converted, err := pipeline.ConvertToUTF8(text[r.convertedEnd:end], encoding, true)
+		if err != nil {
+			r.unconverted = true
+			return text
+		}
+		r.converted = append(r.converted, converted...)
+		r.convertedEnd = end
+	}
+	return r.converted
+}
+
+// StartCommand starts command line on current buffer in background.
+// Screen is redrawn with output received so far until the command exits.
+func (v *MainView) StartCommand(line string) {
+	o := &streamOutput{}
+	r := &runningCommand{line: line, job: v.Pipeline().Start(line, o), output: o, start: time.Now()}
+	v.running = r
+	v.textArea.setText(nil)
+	v.textArea.offset = 0
+
+	go func() {
+		t := time.NewTicker(streamInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-r.job.Done():
+				v.interrupt()
+				return
+			case <-t.C:
+				v.interrupt()
+			}
+		}
+	}()
+}
+
+// pollCommand shows output of running command, and finishes it when it has exited
+func (v *MainView) pollCommand() {
+	select {
+	case <-v.running.job.Done():
+	default:
+		text, _ := v.running.output.received()
+		v.textArea.setText(v.running.display(text, v.buffers[v.current].encoding))
+		v.textArea.scroll(0)
+		return
+	}
+
+	warn, err := v.running.job.Wait()
+	v.running = nil
+	if err == context.Canceled {
+		// Previous text is restored and command line is kept for editing
+		v.syncText()
+		v.stopMacro()
+		v.InputError("canceled")
+		return
+	}
+	v.commandDone(warn, err)
+}
+
+// commandDone updates text and input area with result of command invoked from input area
+func (v *MainView) commandDone(warn string, err error) {
+	v.syncText()
+	if err != nil {
+		// Command line which cannot be parsed is kept for editing
+		if _, ok := err.(*pipeline.ParseError); !ok {
+			v.ClearInputText()
+		}
+		v.stopMacro()
+		v.InputError(err.Error())
+		return
+	}
+	if warn != "" {
+		v.InputError(warn)
+	}
+
+	v.SaveInputHistory()
+	v.ClearInputText()
+}
+
+// HandleRunningKey handles key event while command is running. Only cancel and scroll are accepted.
+func (v *MainView) HandleRunningKey(ev termbox.Event) {
+	switch ev.Key {
+	case termbox.KeyEsc, termbox.KeyCtrlC:
+		v.running.job.Cancel()
+	case termbox.KeyPgup:
+		v.textArea.scroll(-(v.height - TextAreaPos) / 2)
+	case termbox.KeyPgdn:
+		v.textArea.scroll((v.height - TextAreaPos) / 2)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// suggestSampleLines is number of lines used for analysing shape of text
+const suggestSampleLines = 1000
+
+// Log formats detected by analysis
+const (
+	LogNone = iota
+	LogAccess
+	LogSyslog
+)
+
+var (
+	// accessLogRe matches Apache or nginx common/combined log format
+	accessLogRe = regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]+\] "[^"]*" \d{3} \S+`)
+	// syslogRe matches traditional syslog format
+	syslogRe = regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} \S+ [^:\[]+(\[\d+\])?:`)
+	levelRe  = regexp.MustCompile(`\b(ERROR|WARN|WARNING|FATAL|CRITICAL)\b`)
+)
+
+// Shape represents shape of text
+type Shape struct {
+	lines []string
+	// delimiter is 0 when fields are separated by blanks
+	delimiter rune
+	columns   int
+	// distinct is number of distinct values per column
+	distinct   []int
+	numeric    []bool
+	sorted     bool
+	duplicates int
+	logFormat  int
+	levels     int
+}
+
+// AnalyseShape analyses first lines of text
+func AnalyseShape(text []byte) *Shape {
+	s := &Shape{
+		lines:  strings.Split(strings.TrimRight(string(sampleLines(text, suggestSampleLines)), "\n"), "\n"),
+		sorted: true,
+	}
+	if d, ok := DetectDelimiter(text); ok {
+		s.delimiter = d
+	}
+
+	seen := make(map[string]bool)
+	var rows [][]string
+	for n, line := range s.lines {
+		if seen[line] {
+			s.duplicates++
+		}
+		seen[line] = true
+		if n > 0 && s.lines[n-1] > line {
+			s.sorted = false
+		}
+
+		switch {
+		case accessLogRe.MatchString(line):
+			s.logFormat = LogAccess
+		case syslogRe.MatchString(line):
+			s.logFormat = LogSyslog
+		}
+		if levelRe.MatchString(line) {
+			s.levels++
+		}
+
+		rows = append(rows, s.fields(line))
+		if n == 0 || len(rows[n]) < s.columns {
+			s.columns = len(rows[n])
+		}
+	}
+
+	s.distinct = make([]int, s.columns)
+	s.numeric = make([]bool, s.columns)
+	for c := 0; c < s.columns; c++ {
+		values := make(map[string]bool)
+		s.numeric[c] = true
+		for n, row := range rows {
+			values[row[c]] = true
+			// Header of delimiter separated text is not a number
+			if n == 0 && s.delimiter != 0 {
+				continue
+			}
+			if _, err := strconv.ParseFloat(row[c], 64); err != nil {
+				s.numeric[c] = false
+			}
+		}
+		s.distinct[c] = len(values)
+	}
+	return s
+}
+
+func (s *Shape) fields(line string) []string {
+	if s.delimiter == 0 {
+		return strings.Fields(line)
+	}
+	return strings.Split(line, string(s.delimiter))
+}
+
+// awkField returns awk options and field reference of column c
+func (s *Shape) awkField(c int) (string, string) {
+	if s.delimiter == 0 {
+		return "", fmt.Sprintf("$%d", c+1)
+	}
+	d := string(s.delimiter)
+	if s.delimiter == '\t' {
+		d = `\t`
+	}
+	return fmt.Sprintf("-F%s ", pipeline.ShellQuote(d)), fmt.Sprintf("$%d", c+1)
+}
+
+func (s *Shape) countBy(c int) string {
+	opts, f := s.awkField(c)
+	return fmt.Sprintf("awk %s%s", opts, pipeline.ShellQuote(fmt.Sprintf("{ c[%s]++ } END { for (k in c) print c[k], k }", f)))
+}
+
+// Suggestion represents suggested command
+type Suggestion struct {
+	Command string
+	Reason  string
+	score   int
+}
+
+// Suggest returns suggested commands ranked by score, built only from enabled commands
+func (s *Shape) Suggest(enableCommands []string) []Suggestion {
+	var all []Suggestion
+	add := func(score int, command, reason string) {
+		all = append(all, Suggestion{Command: command, Reason: reason, score: score})
+	}
+
+	switch s.logFormat {
+	case LogAccess:
+		add(90, s.countByWhitespace(9), "access log: count by status code")
+		add(85, s.countByWhitespace(1), "access log: count by client address")
+		add(70, `awk '$9 >= 500'`, "access log: server errors")
+	case LogSyslog:
+		add(85, `awk '{ sub(/\[[0-9]+\]:$/, "", $5); sub(/:$/, "", $5); c[$5]++ } END { for (k in c) print c[k], k }'`, "syslog: count by program")
+	}
+	if s.levels > 0 {
+		add(80, `grep -E '\b(ERROR|WARN|WARNING|FATAL|CRITICAL)\b'`, fmt.Sprintf("%d lines with log level", s.levels))
+	}
+
+	if s.duplicates > 0 {
+		if s.sorted {
+			add(75, "uniq -c", fmt.Sprintf("%d duplicate lines, already sorted", s.duplicates))
+			add(60, "uniq", "remove duplicate lines")
+		} else {
+			add(75, "sort", fmt.Sprintf("%d duplicate lines; sort before uniq -c", s.duplicates))
+			add(55, "sort -u", "remove duplicate lines")
+		}
+	} else if !s.sorted {
+		add(40, "sort", "lines are not sorted")
+	}
+
+	if s.columns > 1 {
+		// The column with fewest distinct values is the most useful key to count by
+		best := -1
+		for c := 0; c < s.columns; c++ {
+			if s.numeric[c] || s.distinct[c] < 2 || s.distinct[c] > len(s.lines)/2 {
+				continue
+			}
+			if best < 0 || s.distinct[c] < s.distinct[best] {
+				best = c
+			}
+		}
+		if best >= 0 {
+			add(70, s.countBy(best), fmt.Sprintf("column %d has %d distinct values", best+1, s.distinct[best]))
+		}
+
+		for c := 0; c < s.columns; c++ {
+			if !s.numeric[c] {
+				continue
+			}
+			opts, f := s.awkField(c)
+			add(50, fmt.Sprintf("awk %s%s", opts, pipeline.ShellQuote(fmt.Sprintf("{ s += %s } END { print s }", f))), fmt.Sprintf("column %d is numeric: sum", c+1))
+			if s.delimiter == 0 {
+				add(45, fmt.Sprintf("sort -k%d,%dn", c+1, c+1), fmt.Sprintf("column %d is numeric: sort by it", c+1))
+			} else {
+				add(45, fmt.Sprintf("sort -t%s -k%d,%dn", pipeline.ShellQuote(string(s.delimiter)), c+1, c+1), fmt.Sprintf("column %d is numeric: sort by it", c+1))
+			}
+			break
+		}
+
+		if s.delimiter != 0 && s.delimiter != '\t' {
+			add(30, fmt.Sprintf("cut -d%s -f1", pipeline.ShellQuote(string(s.delimiter))), fmt.Sprintf("%d columns separated by %q", s.columns, s.delimiter))
+		} else {
+			add(30, "awk '{ print $1 }'", fmt.Sprintf("%d columns", s.columns))
+		}
+	}
+
+	if len(s.lines) >= 20 {
+		add(20, "head", "show first lines")
+	}
+	add(10, "wc -l", "count lines")
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].score > all[j].score })
+
+	var suggestions []Suggestion
+	seen := make(map[string]bool)
+	for _, sg := range all {
+		if seen[sg.Command] {
+			continue
+		}
+		seen[sg.Command] = true
+
+		base := strings.SplitN(sg.Command, " ", 2)[0]
+		for _, c := range enableCommands {
+			if c == base {
+				suggestions = append(suggestions, sg)
+				break
+			}
+		}
+	}
+	return suggestions
+}
+
+func (s *Shape) countByWhitespace(field int) string {
+	return fmt.Sprintf("awk %s", pipeline.ShellQuote(fmt.Sprintf("{ c[$%d]++ } END { for (k in c) print c[k], k }", field)))
+}
+
+// SuggestionPicker represent list of suggestions
+type SuggestionPicker struct {
+	suggestions []Suggestion
+	cursor      int
+}
+
+// ToggleSuggestions opens or closes suggestion picker for current text
+func (v *MainView) ToggleSuggestions(enableCommands []string) error {
+	if v.suggestions != nil {
+		v.suggestions = nil
+		return nil
+	}
+
+	suggestions := AnalyseShape(v.textArea.text).Suggest(enableCommands)
+	if len(suggestions) < 1 {
+		return fmt.Errorf("no suggestion from enabled commands")
+	}
+	v.suggestions = &SuggestionPicker{suggestions: suggestions}
+	return nil
+}
+
+// HandleSuggestionsKey handles key for suggestion picker, and reports whether key is consumed
+func (v *MainView) HandleSuggestionsKey(ev termbox.Event) bool {
+	p := v.suggestions
+	switch ev.Key {
+	case termbox.KeyArrowUp, termbox.KeyF5:
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case termbox.KeyArrowDown, termbox.KeyF6:
+		if p.cursor < len(p.suggestions)-1 {
+			p.cursor++
+		}
+	case termbox.KeyEnter:
+		command := p.suggestions[p.cursor].Command
+		v.suggestions = nil
+		v.inputArea.text = []byte(command)
+		v.EndCursor()
+	case termbox.KeyF11:
+		v.suggestions = nil
+	default:
+		return false
+	}
+	return true
+}
+
+// drawSuggestions updates back buffer for suggestion picker over text area
+func (v *MainView) drawSuggestions() {
+	p := v.suggestions
+	drawPaneTitle(v.screen, "suggestions (Up/Down to select, Enter to fill input)", 0, TextAreaPos, v.width)
+
+	for n, sg := range p.suggestions {
+		y := TextAreaPos + 1 + n
+		if y >= v.height {
+			return
+		}
+		fg := ColFg
+		if n == p.cursor {
+			fg |= termbox.AttrReverse
+		}
+		var x int
+		for _, c := range fmt.Sprintf("%-40s  # %s", sg.Command, sg.Reason) {
+			if x+runewidth.RuneWidth(c) > v.width {
+				break
+			}
+			v.screen.SetCell(x, y, c, fg, ColBg)
+			x += runewidth.RuneWidth(c)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+	"github.com/shiimaxx/txtmanip/pipeline"
+)
+
+// delimiters are candidates of delimiter in order of priority
+var delimiters = []rune{'\t', ',', ';', '|'}
+
+// tableSampleLines is number of lines used for detecting delimiter
+const tableSampleLines = 100
+
+// Table represent delimiter separated text
+type Table struct {
+	delimiter rune
+	rows      [][]string
+	widths    []int
+	// quoted is true when any quoted field contains delimiter
+	quoted bool
+}
+
+// DetectDelimiter returns delimiter which splits every sample line into the same number of fields
+func DetectDelimiter(text []byte) (rune, bool) {
+	sample := sampleLines(text, tableSampleLines)
+	for _, d := range delimiters {
+		r := newCSVReader(sample, d)
+		records, err := r.ReadAll()
+		if err != nil || len(records) < 1 || len(records[0]) < 2 {
+			continue
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sampleLines returns first n lines of text
+func sampleLines(text []byte, n int) []byte {
+	var i int
+	for ; n > 0; n-- {
+		j := bytes.IndexByte(text[i:], '\n')
+		if j < 0 {
+			return text
+		}
+		i += j + 1
+	}
+	return text[:i]
+}
+
+func newCSVReader(text []byte, delimiter rune) *csv.Reader {
+	r := csv.NewReader(bytes.NewReader(text))
+	r.Comma = delimiter
+	r.LazyQuotes = delimiter != ','
+	return r
+}
+
+// ParseTable parses text as delimiter separated table whose first row is header
+func ParseTable(text []byte) (*Table, error) {
+	d, ok := DetectDelimiter(text)
+	if !ok {
+		return nil, errors.New("text is not delimiter separated table")
+	}
+
+	rows, err := newCSVReader(text, d).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Table{delimiter: d, rows: rows, widths: make([]int, len(rows[0]))}
+	for _, line := range strings.Split(strings.TrimRight(string(text), "\n"), "\n") {
+		if strings.Count(line, string(d))+1 != len(rows[0]) {
+			t.quoted = true
+			break
+		}
+	}
+	for _, row := range rows {
+		for n, f := range row {
+			if w := runewidth.StringWidth(f); w > t.widths[n] {
+				t.widths[n] = w
+			}
+		}
+	}
+	return t, nil
+}
+
+// isNumeric reports whether every value except header in column n is number
+func (t *Table) isNumeric(n int) bool {
+	for _, row := range t.rows[1:] {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(row[n]), 64); err != nil {
+			return false
+		}
+	}
+	return len(t.rows) > 1
+}
+
+// draw updates back buffer for table. Header is pinned and column n is highlighted.
+func (t *Table) draw(s Screen, x0, y0, width, height, offset, col int) {
+	// First column is shifted so that highlighted column is visible
+	first := 0
+	for first < col {
+		w := 0
+		for n := first; n <= col; n++ {
+			w += t.widths[n] + 1
+		}
+		if w <= width {
+			break
+		}
+		first++
+	}
+
+	drawRow := func(row []string, y int, attr termbox.Attribute) {
+		x := 0
+		for n := first; n < len(row) && n < len(t.widths); n++ {
+			fg := ColFg | attr
+			if n == col {
+				fg |= termbox.AttrReverse
+			}
+			cell := runewidth.FillRight(row[n], t.widths[n])
+			for _, c := range cell {
+				if x+runewidth.RuneWidth(c) > width {
+					return
+				}
+				s.SetCell(x0+x, y, c, fg, ColBg)
+				x += runewidth.RuneWidth(c)
+			}
+			x++
+		}
+	}
+
+	drawRow(t.rows[0], y0, termbox.AttrBold|termbox.AttrUnderline)
+	for y, n := y0+1, offset+1; y < y0+height && n < len(t.rows); y, n = y+1, n+1 {
+		drawRow(t.rows[n], y, 0)
+	}
+}
+
+// csvSplitFunc is awk function splitting s by d into f with respect to double quoted fields
+const csvSplitFunc = `function csvsplit(s, f, d,   n, i, c, q, v) { n = 0; v = ""; q = 0; ` +
+	`for (i = 1; i <= length(s); i++) { c = substr(s, i, 1); ` +
+	`if (q) { if (c == "\"") { if (substr(s, i + 1, 1) == "\"") { v = v c; i++ } else q = 0 } else v = v c } ` +
+	`else if (c == "\"") q = 1; else if (c == d) { f[++n] = v; v = "" } else v = v c } ` +
+	`f[++n] = v; return n } `
+
+// csvColumnLookup sets column index c by header name col
+const csvColumnLookup = `NR == 1 { n = csvsplit($0, h, d); for (i = 1; i <= n; i++) if (h[i] == col) c = i } `
+
+func (t *Table) delimiterArg() string {
+	if t.delimiter == '\t' {
+		return `'\t'`
+	}
+	return pipeline.ShellQuote(string(t.delimiter))
+}
+
+// CutStages returns stages selecting column n.
+// cut is used unless quoted field contains delimiter. Unlike AwkStages, column is referred by its position,
+// since cut cannot look up header and the header cannot be read ahead of the stream by another stage.
+func (t *Table) CutStages(n int) []string {
+	if !t.quoted {
+		if t.delimiter == '\t' {
+			return []string{fmt.Sprintf("cut -f%d", n+1)}
+		}
+		return []string{fmt.Sprintf("cut -d%s -f%d", pipeline.ShellQuote(string(t.delimiter)), n+1)}
+	}
+	return t.AwkStages(n)
+}
+
+// AwkStages returns stages printing column n referred by header name
+func (t *Table) AwkStages(n int) []string {
+	return []string{fmt.Sprintf("awk -v col=%s -v d=%s %s",
+		pipeline.ShellQuote(t.rows[0][n]), t.delimiterArg(),
+		pipeline.ShellQuote(csvSplitFunc+csvColumnLookup+`{ csvsplit($0, f, d); print f[c] }`))}
+}
+
+// SortStages returns stages sorting rows by column n referred by header name, keeping header first.
+// Each line is decorated with its sort key by awk, sorted by the key and undecorated by cut.
+func (t *Table) SortStages(n int) []string {
+	var numeric string
+	if t.isNumeric(n) {
+		numeric = "n"
+	}
+	return []string{
+		fmt.Sprintf("awk -v col=%s -v d=%s %s",
+			pipeline.ShellQuote(t.rows[0][n]), t.delimiterArg(),
+			pipeline.ShellQuote(csvSplitFunc+csvColumnLookup+`{ csvsplit($0, f, d); gsub(/\|/, " ", f[c]); print (NR == 1 ? 0 : 1) "|" f[c] "|" $0 }`)),
+		fmt.Sprintf("sort -s -t'|' -k1,1n -k2,2%s", numeric),
+		"cut -d'|' -f3-",
+	}
+}
+
+// MoveTableColumn moves column cursor of table by n
+func (v *MainView) MoveTableColumn(n int) {
+	if v.table == nil {
+		return
+	}
+	v.tableCol += n
+	if v.tableCol >= len(v.table.widths) {
+		v.tableCol = len(v.table.widths) - 1
+	}
+	if v.tableCol < 0 {
+		v.tableCol = 0
+	}
+}